@@ -0,0 +1,49 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/skelterjohn/wgo/wgo"
+)
+
+// cacheCmd implements 'wgo cache'.
+func cacheCmd(w *workspace, args []string) {
+	if len(args) == 0 {
+		usage()
+	}
+	switch args[0] {
+	case "dir":
+		if jsonOutput {
+			emit(struct{ Dir string }{wgo.CacheDir()})
+			return
+		}
+		fmt.Println(wgo.CacheDir())
+	case "fill":
+		// Populate the cache with everything the workspace pins, so that
+		// later restores work offline.
+		cached, err := wgo.FillCache(&w.Workspace)
+		for _, r := range cached {
+			if jsonOutput {
+				emit(r)
+				continue
+			}
+			fmt.Println(r.URL)
+		}
+		orExit(err)
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/skelterjohn/wgo/wgo"
+)
+
+// exportModules writes a go.mod file for each package tree in the
+// workspace's own src directory, so the code can be consumed in module mode.
+func exportModules(w *workspace, args []string) {
+	var opts wgo.ExportModulesOptions
+	for _, a := range args {
+		switch a {
+		case "--force":
+			opts.Force = true
+		case "--vendor":
+			opts.Vendor = true
+		default:
+			usage()
+		}
+	}
+	opts.Log = os.Stderr
+
+	exported, err := wgo.ExportModules(&w.Workspace, opts)
+	for _, m := range exported {
+		if jsonOutput {
+			emit(m)
+			continue
+		}
+		fmt.Println(m.Path)
+	}
+	// Unpinned imports are left out of the go.mod files, which are still
+	// written, but the files are incomplete, so that is a failure too.
+	orExit(err)
+}
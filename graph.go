@@ -0,0 +1,64 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/skelterjohn/wgo/wgo"
+)
+
+// graph prints the workspace's import graph in DOT or JSON.
+func graph(w *workspace, args []string) {
+	var opts wgo.GraphOptions
+	for _, a := range args {
+		switch {
+		case a == "--json":
+			// The same as 'wgo --json graph'.
+			jsonOutput = true
+		case a == "--dot":
+			// DOT is what is printed without --json.
+		case a == "--repos":
+			opts.ByRepo = true
+		case a == "--external":
+			opts.Kind = wgo.NodeExternal
+		case a == "--workspace":
+			opts.Kind = wgo.NodeWorkspace
+		case a == "--tests":
+			opts.Tests = true
+		case strings.HasPrefix(a, "--depth="):
+			d, err := strconv.Atoi(strings.TrimPrefix(a, "--depth="))
+			if err != nil || d < 1 {
+				fmt.Fprintf(os.Stderr, "bad depth %q\n\n", a)
+				usage()
+			}
+			opts.MaxDepth = d
+		default:
+			fmt.Fprintf(os.Stderr, "unrecognized flag: %s\n\n", a)
+			usage()
+		}
+	}
+
+	dg, err := wgo.Graph(&w.Workspace, opts)
+	orExit(err)
+
+	if jsonOutput {
+		emit(dg)
+		return
+	}
+	orExit(dg.WriteDOT(os.Stdout))
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/skelterjohn/wgo/wgo"
+)
+
+// licenses reports the license of every repository the workspace depends on.
+func licenses(w *workspace, args []string) {
+	noticePath := ""
+	var opts wgo.LicensesOptions
+	for _, a := range args {
+		switch {
+		case a == "--json":
+			// The same as 'wgo --json licenses'.
+			jsonOutput = true
+		case a == "--csv":
+			// CSV is what is printed without --json.
+		case a == "--tests":
+			opts.Tests = true
+		case strings.HasPrefix(a, "--notice="):
+			noticePath = strings.TrimPrefix(a, "--notice=")
+		case strings.HasPrefix(a, "--deny="):
+			for _, id := range strings.Split(strings.TrimPrefix(a, "--deny="), ",") {
+				if id != "" {
+					opts.Deny = append(opts.Deny, id)
+				}
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "unrecognized flag: %s\n\n", a)
+			usage()
+		}
+	}
+
+	repos, denied := wgo.Licenses(&w.Workspace, opts)
+	if _, ok := denied.(wgo.Errors); denied != nil && !ok {
+		orExit(denied)
+	}
+
+	if jsonOutput {
+		for _, r := range repos {
+			emit(r)
+		}
+	} else {
+		cw := csv.NewWriter(os.Stdout)
+		cw.Write([]string{"repo", "dir", "url", "revision", "license", "files"})
+		for _, r := range repos {
+			cw.Write([]string{r.ImportPath, r.Dir, r.URL, r.Rev, strings.Join(r.Licenses, " "), strings.Join(r.Files, " ")})
+		}
+		cw.Flush()
+		orExit(cw.Error())
+	}
+
+	if noticePath != "" {
+		orExit(wgo.WriteNotice(noticePath, repos))
+	}
+	orExit(denied)
+}
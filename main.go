@@ -19,12 +19,15 @@ to manage that workspace.
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/skelterjohn/wgo/workspaces"
 )
 
 const (
@@ -38,15 +41,37 @@ const getFlag = "--vendor-gopath"
 var usageMessage = fmt.Sprintf(`wgo is a tool for managing Go workspaces.
 
 usage: wgo init [%s=VENDOR_GOPATH] [ADDITIONAL_GOPATH+]
-       wgo restore
-       wgo save [--godeps] [PACKAGE+]
-       wgo vendor [PACKAGE+]
-       wgo purge [GOPATH+]
+       wgo config [migrate]
+       wgo env --workspace
+       wgo restore [-j N] [--offline] [--no-cache] [--verify]
+       wgo verify [REPO+]
+       wgo cache fill|dir
+       wgo status
+       wgo outdated [--json]
+       wgo update [REPO[@REV|@TAG|@CONSTRAINT]+]
+       wgo save [--platforms=LIST] [--godeps] [--gomod] [--glide] [--dep] [--vndr] [PACKAGE+]
+       wgo vendor [--platforms=LIST] [--link=hard|reflink|copy|auto] [--prune] [PACKAGE+]
+       wgo vendor --refresh [--link=hard|reflink|copy|auto] [--prune] [PACKAGE+]
+       wgo prune [--platforms=LIST] [--dry-run]
+       wgo why IMPORTPATH
+       wgo graph [--json] [--repos] [--external|--workspace] [--tests] [--depth=N]
+       wgo licenses [--json] [--tests] [--notice=FILE] [--deny=LICENSE[,LICENSE]+]
+       wgo export-modules [--vendor] [--force]
+       wgo purge [--platforms=LIST] [--no-tests] [--by-repo [--unpin]|--by-dir] [--confirm] [GOPATH+]
+       wgo purge --undo [ID]
+       wgo purge --empty-trash
 
        wgo <go command>  # run a go command with the workspace's gopaths
+
+Put --json before a wgo command to get its results and errors as JSON on stdout.
 `, getFlag)
 
 func usage() {
+	if jsonOutput {
+		fmt.Fprint(os.Stderr, usageMessage)
+		output.Errors = append(output.Errors, jsonError{Message: "invalid usage"})
+		exit(1)
+	}
 	fmt.Print(usageMessage)
 	os.Exit(1)
 }
@@ -64,8 +89,8 @@ func orExit(err error) {
 	if err == nil {
 		return
 	}
-	fmt.Fprintf(os.Stderr, "%s\n", err)
-	os.Exit(1)
+	reportErrors(err)
+	exit(1)
 }
 
 func main() {
@@ -73,27 +98,88 @@ func main() {
 		fmt.Println(usageMessage)
 		shellOutToGo(os.Args)
 	}
+	if os.Args[1] == "--json" {
+		jsonOutput = true
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+		if len(os.Args) == 1 {
+			usage()
+		}
+	}
+	output.Command = os.Args[1]
 	var err error
 	switch os.Args[1] {
 	case "init":
 		if err = initWgo(os.Args[2:]); err != nil {
-			fmt.Fprintf(os.Stderr, "%s\n", err)
+			reportError(err)
 		}
 	case "vendor":
 		w, err := getCurrentWorkspace()
 		orExit(err)
 		vendor(w, os.Args[2:])
 	case "restore":
-		if len(os.Args) != 2 {
-			usage()
-		}
 		w, err := getCurrentWorkspace()
 		orExit(err)
-		restore(w)
+		restore(w, os.Args[2:])
+	case "cache":
+		w, err := getCurrentWorkspace()
+		orExit(err)
+		cacheCmd(w, os.Args[2:])
+	case "prune":
+		w, err := getCurrentWorkspace()
+		orExit(err)
+		prune(w, os.Args[2:])
 	case "purge":
 		w, err := getCurrentWorkspace()
 		orExit(err)
 		purge(w, os.Args[2:])
+	case "outdated":
+		w, err := getCurrentWorkspace()
+		orExit(err)
+		outdated(w, os.Args[2:])
+	case "update":
+		w, err := getCurrentWorkspace()
+		orExit(err)
+		update(w, os.Args[2:])
+	case "verify":
+		w, err := getCurrentWorkspace()
+		orExit(err)
+		verify(w, os.Args[2:])
+	case "status":
+		w, err := getCurrentWorkspace()
+		orExit(err)
+		status(w, os.Args[2:])
+	case "graph":
+		w, err := getCurrentWorkspace()
+		orExit(err)
+		graph(w, os.Args[2:])
+	case "why":
+		w, err := getCurrentWorkspace()
+		orExit(err)
+		why(w, os.Args[2:])
+	case "licenses":
+		w, err := getCurrentWorkspace()
+		orExit(err)
+		licenses(w, os.Args[2:])
+	case "export-modules":
+		w, err := getCurrentWorkspace()
+		orExit(err)
+		exportModules(w, os.Args[2:])
+	case "env":
+		w, err := getCurrentWorkspace()
+		if len(os.Args) == 3 && os.Args[2] == "--workspace" {
+			orExit(err)
+			workspaceEnv(w)
+			exit(0)
+		}
+		if err == nil {
+			w.shellOutToGo(os.Args)
+		} else {
+			shellOutToGo(os.Args)
+		}
+	case "config":
+		w, err := getCurrentWorkspace()
+		orExit(err)
+		config(w, os.Args[2:])
 	case "save":
 		w, err := getCurrentWorkspace()
 		orExit(err)
@@ -106,6 +192,7 @@ func main() {
 			shellOutToGo(os.Args)
 		}
 	}
+	exit(0)
 }
 
 func initWgo(args []string) error {
@@ -146,17 +233,14 @@ func initWgo(args []string) error {
 		args = []string{getFlag, "vendor"}
 	}
 
-	gopathsPath := filepath.Join(wd, ConfigDirName, "gopaths")
-	// if there is no gopaths yet, stick '.' in there.
-	if _, err := os.Stat(gopathsPath); err != nil {
+	gopathsPath := filepath.Join(wd, ConfigDirName, workspaces.GopathsFileName)
+	_, gopathsErr := os.Stat(gopathsPath)
+	// if there is no configuration yet, stick '.' in there.
+	if gopathsErr != nil && !w.HasConfig() {
 		args = append([]string{"."}, args...)
 	}
 
-	var fout *os.File
-	if fout, err = os.Create(gopathsPath); err != nil {
-		return err
-	}
-	defer fout.Close()
+	var gopaths []string
 
 	checkGopath := func(gopath string) {
 		if filepath.IsAbs(gopath) {
@@ -174,7 +258,7 @@ func initWgo(args []string) error {
 			}
 			goGetDir = args[i+1]
 			checkGopath(goGetDir)
-			fmt.Fprintln(fout, goGetDir)
+			gopaths = append(gopaths, goGetDir)
 			i++
 			continue
 		}
@@ -183,7 +267,7 @@ func initWgo(args []string) error {
 			goGetDir = args[i][len(getFlag+"="):]
 
 			checkGopath(goGetDir)
-			fmt.Fprintln(fout, goGetDir)
+			gopaths = append(gopaths, goGetDir)
 			continue
 		}
 
@@ -200,15 +284,60 @@ func initWgo(args []string) error {
 			continue
 		}
 		alreadyListed[gopath] = true
-		fmt.Fprintln(fout, gopath)
+		gopaths = append(gopaths, gopath)
 	}
 	for _, gopath := range gopathArgs {
 		if _, ok := alreadyListed[gopath]; ok {
 			continue
 		}
 		alreadyListed[gopath] = true
-		fmt.Fprintln(fout, gopath)
+		gopaths = append(gopaths, gopath)
+	}
+
+	// Workspaces that still use .gocfg/gopaths keep using it until they are
+	// migrated with 'wgo config migrate'.
+	if gopathsErr == nil && !w.HasConfig() {
+		return ioutil.WriteFile(gopathsPath, []byte(strings.Join(gopaths, "\n")+"\n"), 0644)
 	}
 
-	return nil
+	w.Gopaths = gopaths
+	if goGetDir != "" {
+		w.VendorGopath = goGetDir
+	}
+	return w.WriteConfig()
+}
+
+// workspaceEnv prints the environment variables wgo sets for commands run in
+// the workspace.
+func workspaceEnv(w *workspace) {
+	type envVar struct {
+		Key, Value string
+	}
+	vars := []envVar{}
+	for _, ev := range w.Environment() {
+		vars = append(vars, envVar{ev.Key, ev.Value})
+	}
+	vars = append(vars, envVar{"GOPATH", w.Gopath(true)})
+	for _, ev := range vars {
+		if jsonOutput {
+			emit(ev)
+			continue
+		}
+		fmt.Printf("%s=%q\n", ev.Key, ev.Value)
+	}
+}
+
+func config(w *workspace, args []string) {
+	switch {
+	case len(args) == 0 && jsonOutput:
+		emit(w.Config())
+	case len(args) == 0:
+		data, err := json.MarshalIndent(w.Config(), "", "\t")
+		orExit(err)
+		fmt.Println(string(data))
+	case len(args) == 1 && args[0] == "migrate":
+		orExit(w.MigrateConfig())
+	default:
+		usage()
+	}
 }
@@ -0,0 +1,66 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/skelterjohn/wgo/wgo"
+)
+
+// outdated reports, for every pin, the upstream default branch tip and newest
+// release tag.
+func outdated(w *workspace, args []string) {
+	for _, a := range args {
+		switch a {
+		case "--json":
+			// The same as 'wgo --json outdated'.
+			jsonOutput = true
+		default:
+			usage()
+		}
+	}
+
+	ages, err := wgo.Outdated(&w.Workspace)
+	orExit(err)
+
+	if jsonOutput {
+		for _, a := range ages {
+			emit(a)
+		}
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPO\tPINNED\tDATE\tBEHIND\tTIP\tLATEST TAG")
+	for _, a := range ages {
+		if a.Error != "" {
+			fmt.Fprintf(tw, "%s\t%s\terror: %s\t\t\t\n", a.Dir, wgo.ShortRev(a.Pinned), a.Error)
+			continue
+		}
+		date := "?"
+		if a.PinnedDate != nil {
+			date = a.PinnedDate.Format("2006-01-02")
+		}
+		behind := "?"
+		if a.Behind >= 0 {
+			behind = strconv.Itoa(a.Behind)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", a.Dir, wgo.ShortRev(a.Pinned), date, behind, wgo.ShortRev(a.Tip), a.LatestTag)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/skelterjohn/wgo/wgo"
+)
+
+// jsonOutput is set by the global --json flag. Subcommands then hand their
+// results to emit instead of printing them, and a single jsonReport is
+// written to stdout when the command exits. Messages for people still go to
+// stderr.
+var jsonOutput bool
+
+// jsonReport is what 'wgo --json' writes. Results holds one object per item
+// the command dealt with; their fields depend on the command, and are listed
+// in the README.
+type jsonReport struct {
+	Command string
+	Results []interface{}
+	Errors  []jsonError
+}
+
+// jsonError is an error in a jsonReport. Op and Path are set for errors about
+// a particular file.
+type jsonError struct {
+	Op      string `json:",omitempty"`
+	Path    string `json:",omitempty"`
+	Message string
+}
+
+var output = jsonReport{
+	Results: []interface{}{},
+	Errors:  []jsonError{},
+}
+
+// emit adds a result to the report.
+func emit(v interface{}) {
+	output.Results = append(output.Results, v)
+}
+
+// reportError prints err to stderr and adds it to the report.
+func reportError(err error) {
+	fmt.Fprintf(os.Stderr, "%s\n", err)
+	je := jsonError{Message: err.Error()}
+	switch e := err.(type) {
+	case *os.PathError:
+		je = jsonError{Op: e.Op, Path: e.Path, Message: e.Err.Error()}
+	case *os.LinkError:
+		je = jsonError{Op: e.Op, Path: e.Old, Message: e.Err.Error()}
+	}
+	output.Errors = append(output.Errors, je)
+}
+
+// reportErrorAt is reportError for an error about path.
+func reportErrorAt(path string, err error) {
+	fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+	je := jsonError{Path: path, Message: err.Error()}
+	if e, ok := err.(*os.PathError); ok {
+		je = jsonError{Op: e.Op, Path: e.Path, Message: e.Err.Error()}
+	}
+	output.Errors = append(output.Errors, je)
+}
+
+// reportErrors reports err, or each of the errors in a wgo.Errors. Errors
+// about one item are reported at that item.
+func reportErrors(err error) {
+	switch e := err.(type) {
+	case wgo.Errors:
+		for _, err := range e {
+			reportErrors(err)
+		}
+	case *wgo.ItemError:
+		reportErrorAt(e.Item, e.Err)
+	default:
+		reportError(err)
+	}
+}
+
+// toStderr runs f with its standard output sent to stderr under --json, for
+// code that prints results wgo can't capture.
+func toStderr(f func()) {
+	if !jsonOutput {
+		f()
+		return
+	}
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = stdout }()
+	f()
+}
+
+// exit writes the report, with --json, and exits.
+func exit(code int) {
+	if jsonOutput {
+		data, err := json.MarshalIndent(output, "", "\t")
+		if err == nil {
+			fmt.Println(string(data))
+		}
+	}
+	os.Exit(code)
+}
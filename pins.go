@@ -14,168 +14,84 @@ limitations under the License.
 package main
 
 import (
-	"bytes"
 	"fmt"
-	"go/build"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"runtime"
 	"strings"
 
-	"github.com/skelterjohn/vfu/vend"
+	"github.com/skelterjohn/wgo/wgo"
 )
 
-func (w *workspace) getOutsidePackages(targets []string) map[string]string {
-	os.Setenv("GOPATH", w.Gopath(true))
-
-	for _, gopath := range w.Gopaths {
-		target := "./" + gopath + "/src/..." // filepath.Join() doesn't like a leading dot.
-		targets = append(targets, target)
-	}
-
-	goListTestArgs := []string{"list", "-e", "-f", "{{range .TestImports}}{{.}}\n{{end}}"}
-	goListTestArgs = append(goListTestArgs, targets...)
-	// fmt.Printf("%q\n", goListTestArgs)
-	var testBuf bytes.Buffer
-	cmd := exec.Command("go", goListTestArgs...)
-	cmd.Dir = w.Root
-	cmd.Stdout = &testBuf
-	orExit(cmd.Run())
-	for _, pkg := range strings.Split(testBuf.String(), "\n") {
-		targets = append(targets, pkg)
-	}
-
-	goListArgs := []string{"list", "-e", "-f", "{{.ImportPath}}\n{{range .Deps}}{{.}}\n{{end}}"}
-	goListArgs = append(goListArgs, targets...)
-	// fmt.Printf("%q\n", goListArgs)
-	var buf bytes.Buffer
-	cmd = exec.Command("go", goListArgs...)
-	cmd.Dir = w.Root
-	cmd.Stdout = &buf
-	orExit(cmd.Run())
-
-	goroot := runtime.GOROOT()
-	build.Default.GOPATH = w.Gopath(true)
-
-	pkgs := map[string]string{}
-	for _, pkg := range strings.Split(buf.String(), "\n") {
-		if pkg == "" {
-			continue
-		}
-		p, err := build.Import(pkg, w.Root, build.FindOnly)
-		if err != nil {
-			continue
-		}
-		if x, err := filepath.Rel(goroot, p.Dir); err == nil && !strings.HasPrefix(x, "..") {
-			continue
-		}
-		pkgs[pkg] = p.Dir
-	}
-
-	for pkg, dir := range pkgs {
-		if !filepath.IsAbs(dir) {
-			continue
-		}
-		if x, err := filepath.Rel(w.Root, dir); err == nil && !strings.HasPrefix(x, "..") {
-			continue
-		}
-		pkgs[pkg] = dir
-	}
-
-	return pkgs
-}
-
 func save(w *workspace, args []string) {
-
-	var targets []string
-	godeps := false
+	args, plats := platformsArg(args)
+	opts := wgo.SaveOptions{Platforms: plats, Log: os.Stderr}
 	for _, t := range args {
-		if t == "--godeps" {
-			godeps = true
-		} else {
-			targets = append(targets, t)
+		switch {
+		case t == "--godeps":
+			opts.Godeps = true
+		case t == "--gomod":
+			opts.Gomod = true
+		case t == "--glide", t == "--dep", t == "--vndr":
+			opts.LockFormats = append(opts.LockFormats, t[2:])
+		case strings.HasPrefix(t, "--import="):
+			opts.LockFormats = append(opts.LockFormats, strings.TrimPrefix(t, "--import="))
+		default:
+			opts.Targets = append(opts.Targets, t)
 		}
 	}
 
-	pkgs := w.getOutsidePackages(targets)
-
-	addonMapping := map[string]string{}
-	for pkg, dir := range pkgs {
-		destination := filepath.Join(w.vendorRootSrc(), pkg)
-		// if it's already in here, vendor will pick it up
-		if !filepath.IsAbs(dir) {
-			continue
-		}
-		if x, err := filepath.Rel(w.Root, dir); err == nil && !strings.HasPrefix(x, "..") {
-			continue
-		}
-		addonMapping[destination] = dir
-	}
-
-	var addons []string
-	for destination, dir := range addonMapping {
-		addons = append(addons, destination+"="+dir)
+	var saved []wgo.SavedRepo
+	var err error
+	// vfu prints what it saves on stdout.
+	toStderr(func() {
+		saved, err = wgo.Save(&w.Workspace, opts)
+	})
+	orExit(err)
+	for _, r := range saved {
+		emit(r)
 	}
+}
 
-	var rgits, rhgs []string
-	if godeps {
-		for _, dd := range w.importGodeps() {
-			rarg := dd.root + "=" + dd.repo + "@" + dd.rev
-			switch dd.kind {
-			case "git":
-				rgits = append(rgits, rarg)
-			case "hg":
-				rhgs = append(rhgs, rarg)
-			default:
-				fmt.Fprintf(os.Stderr, "unsupported VCS %q\n", dd.kind)
+func vendor(w *workspace, args []string) {
+	args, plats := platformsArg(args)
+	opts := wgo.VendorOptions{Platforms: plats, Log: os.Stderr}
+	for _, a := range args {
+		switch {
+		case a == "--refresh":
+			opts.Refresh = true
+		case a == "--prune":
+			opts.Prune = true
+		case strings.HasPrefix(a, "--link="):
+			opts.Link = strings.TrimPrefix(a, "--link=")
+			if !wgo.ValidLinkMode(opts.Link) {
+				fmt.Fprintf(os.Stderr, "unknown link mode %q\n\n", opts.Link)
+				usage()
 			}
+		default:
+			opts.Targets = append(opts.Targets, a)
 		}
 	}
 
-	ignoreDirs := []string{".git", ".hg", ".gocfg"}
-	for _, gopath := range w.Gopaths {
-		ignoreDirs = append(ignoreDirs,
-			filepath.Join(gopath, "pkg"),
-			filepath.Join(gopath, "bin"))
+	result, err := wgo.Vendor(&w.Workspace, opts)
+	for _, p := range result.Packages {
+		switch {
+		case jsonOutput:
+			emit(p)
+		case !opts.Refresh:
+			fmt.Println(p.ImportPath)
+		case p.OldRev != "" && !wgo.SameRev(p.OldRev, p.Rev):
+			fmt.Printf("%s: %s -> %s\n", p.Destination, wgo.ShortRev(p.OldRev), wgo.ShortRev(p.Rev))
+		default:
+			fmt.Println(p.Destination)
+		}
 	}
-	ignored := map[string]bool{}
-	for _, dir := range ignoreDirs {
-		ignored[dir] = true
+	// Only mention links when asked to make them.
+	if opts.Link != "" && opts.Link != wgo.LinkCopy {
+		fmt.Fprintln(os.Stderr, result.Stats)
 	}
-
-	cfgPath := filepath.Join(w.Root, ConfigDirName, "vendor.json")
-
-	vend.Save(w.Root, cfgPath, addons, rgits, rhgs, ignored, true)
-}
-
-func vendor(w *workspace, targets []string) {
-	pkgs := w.getOutsidePackages(targets)
-
-	firstGopath := "."
-	if len(w.Gopaths) != 0 {
-		firstGopath = w.Gopaths[0]
-	}
-
-	for pkg, dir := range pkgs {
-		destination := filepath.Join(firstGopath, "src", pkg)
-		// if it's already in here, vendor will pick it up
-		if !filepath.IsAbs(dir) {
-			continue
-		}
-		if x, err := filepath.Rel(w.Root, dir); err == nil && !strings.HasPrefix(x, "..") {
-			continue
+	if result.Pruned != nil {
+		for _, path := range result.Pruned.Paths {
+			emit(wgo.PathAction{Path: path, Action: "removed"})
 		}
-		if _, err := os.Stat(destination); err == nil {
-			continue
-		}
-		fmt.Println(pkg)
-		copyDir(dir, destination)
 	}
-}
-
-func restore(w *workspace) {
-	cfgPath := filepath.Join(w.Root, ConfigDirName, "vendor.json")
-
-	vend.Restore(w.Root, cfgPath)
+	orExit(err)
 }
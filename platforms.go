@@ -0,0 +1,38 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+
+	"github.com/skelterjohn/wgo/wgo"
+)
+
+const platformsFlag = "--platforms="
+
+// platformsArg removes a --platforms flag from args. It returns the remaining
+// arguments and the flag's platforms, or nil to use the workspace's.
+func platformsArg(args []string) ([]string, []wgo.Platform) {
+	var rest, specs []string
+	for _, a := range args {
+		if strings.HasPrefix(a, platformsFlag) {
+			specs = append(specs, strings.TrimPrefix(a, platformsFlag))
+			continue
+		}
+		rest = append(rest, a)
+	}
+	plats, err := wgo.ParsePlatforms(specs)
+	orExit(err)
+	return rest, plats
+}
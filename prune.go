@@ -0,0 +1,49 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/skelterjohn/wgo/wgo"
+)
+
+// prune removes what the workspace's packages don't need from the
+// dependencies in the vendor gopath.
+func prune(w *workspace, args []string) {
+	args, plats := platformsArg(args)
+	opts := wgo.PruneOptions{Platforms: plats, Log: os.Stderr}
+	for _, a := range args {
+		switch a {
+		case "--dry-run":
+			opts.DryRun = true
+		default:
+			fmt.Fprintf(os.Stderr, "unrecognized flag: %s\n\n", a)
+			usage()
+		}
+	}
+	result, err := wgo.Prune(&w.Workspace, opts)
+	for _, path := range result.Paths {
+		switch {
+		case !opts.DryRun:
+			emit(wgo.PathAction{Path: path, Action: "removed"})
+		case jsonOutput:
+			emit(wgo.PathAction{Path: path, Action: "prune"})
+		default:
+			fmt.Println(path)
+		}
+	}
+	orExit(err)
+}
@@ -15,192 +15,127 @@ package main
 
 import (
 	"fmt"
-	"go/build"
 	"os"
 	"path/filepath"
-	"sort"
-	"strings"
+	"time"
+
+	"github.com/skelterjohn/wgo/wgo"
+	"github.com/skelterjohn/wgo/workspaces"
 )
 
 // Purge directories in the indicated gopaths if they to not contain source
 // referenced from a non-indicated gopath.
 func purge(w *workspace, args []string) {
-	confirmed := false
-	var gopaths []string
+	args, plats := platformsArg(args)
+	opts := wgo.PurgeOptions{Platforms: plats, Log: os.Stderr}
+	undo, emptyTrash := false, false
 	for _, a := range args {
-		if a == "--confirm" {
-			confirmed = true
-			continue
+		switch a {
+		case "--confirm":
+			opts.Confirm = true
+		case "--no-tests":
+			opts.NoTests = true
+		case "--undo":
+			undo = true
+		case "--empty-trash":
+			emptyTrash = true
+		case "--by-repo":
+			opts.ByRepo, opts.ByDir = true, false
+		case "--by-dir":
+			opts.ByRepo, opts.ByDir = false, true
+		case "--unpin":
+			opts.Unpin = true
+		default:
+			opts.Gopaths = append(opts.Gopaths, a)
 		}
-		gopaths = append(gopaths, a)
-	}
-	bctx := build.Default
-	bctx.GOPATH = w.Gopath(false)
-
-	if len(gopaths) == 0 {
-		gopaths = w.Gopaths[:1] // By default, the first one is vendor/.
-	}
-	if len(gopaths) == 0 {
-		fmt.Fprintf(os.Stderr, "must purge at least one GOPATH\n")
-		os.Exit(1)
 	}
-	wgps := map[string]bool{}
-	for _, wpg := range w.Gopaths {
-		wgps[wpg] = true
-	}
-	pgs := map[string]bool{}
-	for _, pg := range gopaths {
-		pgs[pg] = true
-		if !wgps[pg] {
-			fmt.Fprintf(os.Stderr, "unknown GOPATH %q", pg)
-			os.Exit(1)
+	switch {
+	case undo && emptyTrash:
+		orExit(fmt.Errorf("cannot use --undo with --empty-trash"))
+	case undo:
+		// The only argument, if any, is the purge to undo.
+		if len(opts.Gopaths) > 1 {
+			orExit(fmt.Errorf("--undo takes at most one purge ID"))
 		}
-	}
-	if len(gopaths) == len(w.Gopaths) {
-		fmt.Fprintf(os.Stderr, "cannot purge all GOPATHs; try 'rm -r' instead\n")
-		os.Exit(1)
-	}
-
-	// Collect a set of safe directories that will not get purged.
-	safeDirs := []string{}
-	// Keep them in a map too, to protect against loops.
-	safeDirsAll := map[string]bool{}
-	// Start by adding all directories in the non-purged gopaths.
-	for _, wpg := range w.Gopaths {
-		if pgs[wpg] {
-			// skip the purged ones
-			continue
-		}
-		// Only deal with abs paths from here on out, to make checking easier.
-		if !filepath.IsAbs(wpg) {
-			wpg = filepath.Join(w.Root, wpg)
+		id := ""
+		if len(opts.Gopaths) == 1 {
+			id = opts.Gopaths[0]
 		}
-		filepath.Walk(filepath.Join(wpg, "src"), func(path string, info os.FileInfo, err error) error {
-			if info.IsDir() {
-				safeDirs = append(safeDirs, path)
-				safeDirsAll[path] = true
-			}
-			return nil
-		})
+		purgeUndo(w, id)
+		return
+	case emptyTrash:
+		size, err := wgo.EmptyTrash(&w.Workspace)
+		orExit(err)
+		fmt.Fprintf(os.Stderr, "emptied the trash, %s\n", wgo.FormatBytes(size))
+		return
 	}
-
-	// Go through each safe dir and add its subsafedirs to the end of the list.
-	for i := 0; i < len(safeDirs); i++ {
-		deps, err := getDepDirs(bctx, safeDirs[i])
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "problem inspecting %s: %v\n", safeDirs[i], err)
-			os.Exit(1)
-		}
-		for _, d := range deps {
-			if safeDirsAll[d] {
-				// cut off cycles
-				continue
-			}
-			safeDirs = append(safeDirs, d)
-			safeDirsAll[d] = true
-		}
+	if opts.Unpin && opts.ByDir {
+		orExit(fmt.Errorf("--unpin only works with --by-repo"))
 	}
 
-	// Expand the list of safe dirs to be all parents of safe dirs, to make checking easier later.
-	for dir := range safeDirsAll {
-		for _, parent := range getAllParents(dir) {
-			safeDirsAll[parent] = true
+	result, err := wgo.Purge(&w.Workspace, opts)
+	if !opts.Confirm {
+		orExit(err)
+	}
+	var kept, purged, unpinned []wgo.PathAction
+	trashed := 0
+	for _, a := range result.Actions {
+		emit(a)
+		switch a.Action {
+		case "keep":
+			kept = append(kept, a)
+		case "purge":
+			purged = append(purged, a)
+		case "unpin":
+			unpinned = append(unpinned, a)
+		case "trashed":
+			trashed++
 		}
 	}
-
-	// Armed with a list of safe dirs, go through gopaths and purge those that aren't safe.
-	dirsToPurge := map[string]bool{}
-	for _, pg := range gopaths {
-		if !filepath.IsAbs(pg) {
-			pg = filepath.Join(w.Root, pg)
+	if opts.Confirm {
+		if result.Trash != "" {
+			fmt.Fprintf(os.Stderr, "moved %d directories to %s; undo with 'wgo purge --undo %s'\n",
+				trashed, filepath.Join(workspaces.ConfigDirName, "trash", result.Trash), result.Trash)
 		}
-		filepath.Walk(filepath.Join(pg, "src"), func(path string, info os.FileInfo, err error) error {
-			if !info.IsDir() {
-				return nil
-			}
-			// If this directory is safe, or is the parent of somethinge safe, we keep it.
-			// We stored all the parents of the safe directories so we only need to do a single check here.
-			if safeDirsAll[path] {
-				return nil
-			}
-			// Not safe, will be purged.
-			dirsToPurge[path] = true
-			return nil
-		})
-	}
-
-	for d := range dirsToPurge {
-		// If we're already removing a parent, forget about this directory.
-		pds := getAllParents(d)
-		for _, pd := range pds {
-			if dirsToPurge[pd] {
-				dirsToPurge[d] = false
-			} else {
-				//fmt.Println("no parent", pd, d)
-			}
+		if errs, ok := err.(wgo.Errors); ok {
+			reportErrors(errs)
+			orExit(fmt.Errorf("purge finished with %d errors", len(errs)))
 		}
-	}
-
-	sortedPurge := []string{}
-	for d, rm := range dirsToPurge {
-		if rm {
-			rd, err := filepath.Rel(w.Root, d)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "problem with relative path for %q: %v\n", d, err)
-				os.Exit(1)
-			}
-			if strings.HasPrefix(rd, "..") {
-				fmt.Fprintf(os.Stderr, "skipping path outside of workspace %q", d)
-				continue
-			}
-			sortedPurge = append(sortedPurge, rd)
+		orExit(err)
+		if result.Trash == "" {
+			fmt.Fprintln(os.Stderr, "nothing to purge")
 		}
+		return
 	}
-	sort.Strings(sortedPurge)
-
-	if !confirmed {
-		fmt.Fprintln(os.Stderr, "Directories containing no imported source:")
-		for _, d := range sortedPurge {
-			fmt.Println(d)
-		}
-		fmt.Fprintln(os.Stderr, "To delete the listed directories, run this command again with '--confirm'.")
-		os.Exit(0)
+	if jsonOutput {
+		return
 	}
 
-	for _, d := range sortedPurge {
-		if err := os.RemoveAll(filepath.Join(w.Root, d)); err != nil {
-			fmt.Println("Error removing %q: %v\n", d, err)
+	if len(kept) != 0 {
+		fmt.Fprintln(os.Stderr, "Directories kept:")
+		for _, a := range kept {
+			fmt.Fprintf(os.Stderr, "  %s (%s)\n", a.Path, a.Reason)
 		}
 	}
-
-}
-
-func getDepDirs(bctx build.Context, dir string) ([]string, error) {
-	pkg, err := bctx.ImportDir(dir, 0)
-	if err != nil {
-		if _, ok := err.(*build.NoGoError); !ok {
-			return nil, err
-		}
+	fmt.Fprintln(os.Stderr, "Directories containing no imported source:")
+	for _, a := range purged {
+		fmt.Println(a.Path)
 	}
-	depDirs := []string{}
-	for _, imp := range pkg.Imports {
-		depPkg, err := bctx.Import(imp, dir, 0)
-		if err == nil {
-			depDirs = append(depDirs, depPkg.Dir)
+	if len(unpinned) != 0 {
+		fmt.Fprintf(os.Stderr, "These pins would be removed from %s:\n", filepath.Join(workspaces.ConfigDirName, "vendor.json"))
+		for _, a := range unpinned {
+			fmt.Fprintf(os.Stderr, "  %s\n", a.Path)
 		}
 	}
-	return depDirs, nil
+	fmt.Fprintln(os.Stderr, "To delete the listed directories, run this command again with '--confirm'.")
 }
 
-func getAllParents(dir string) []string {
-	var parents []string
-	for {
-		parent, _ := filepath.Split(dir)
-		parent = filepath.Clean(parent)
-		if parent == dir {
-			return parents
-		}
-		parents = append(parents, parent)
-		dir = parent
-	}
+// purgeUndo restores the purge id, or the most recent one if id is empty.
+func purgeUndo(w *workspace, id string) {
+	result, err := wgo.UndoPurge(&w.Workspace, id)
+	for _, path := range result.Restored {
+		emit(wgo.PathAction{Path: path, Action: "restored", Trash: result.ID})
+	}
+	orExit(err)
+	fmt.Fprintf(os.Stderr, "restored %d directories purged at %s\n", len(result.Restored), result.Time.Local().Format(time.Stamp))
 }
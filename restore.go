@@ -0,0 +1,115 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/skelterjohn/wgo/wgo"
+)
+
+func restore(w *workspace, args []string) {
+	var opts wgo.RestoreOptions
+	verifySums := false
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--offline":
+			opts.Offline = true
+		case a == "--no-cache":
+			opts.NoCache = true
+		case a == "--verify":
+			verifySums = true
+		case a == "-j":
+			if i+1 >= len(args) {
+				usage()
+			}
+			i++
+			opts.Jobs = parseJobs(args[i])
+		case strings.HasPrefix(a, "-j"):
+			opts.Jobs = parseJobs(strings.TrimPrefix(strings.TrimPrefix(a, "-j"), "="))
+		default:
+			usage()
+		}
+	}
+	if opts.NoCache && opts.Offline {
+		orExit(fmt.Errorf("--offline needs the cache"))
+	}
+
+	var results []wgo.RestoreResult
+	var err error
+	if opts.NoCache {
+		// vfu prints what it restores on stdout.
+		toStderr(func() {
+			results, err = wgo.Restore(&w.Workspace, opts)
+		})
+		orExit(err)
+		for _, r := range results {
+			emit(r)
+		}
+		if verifySums {
+			verifyRestored(w)
+		}
+		return
+	}
+
+	opts.Progress = func(dir, state string) {
+		fmt.Fprintf(os.Stderr, "%-12s %s\n", state, dir)
+	}
+	results, err = wgo.Restore(&w.Workspace, opts)
+	failed := 0
+	for _, r := range results {
+		if r.State == wgo.RestoreFailed {
+			failed++
+		}
+		if jsonOutput || r.State == wgo.RestoreFailed {
+			emit(r)
+			continue
+		}
+		fmt.Println(r.Dir)
+	}
+	if err != nil {
+		if failed != 0 {
+			fmt.Fprintf(os.Stderr, "failed to restore %d of %d repositories:\n", failed, len(results))
+		}
+		orExit(err)
+	}
+	if verifySums {
+		verifyRestored(w)
+	}
+}
+
+// verifyRestored checks restored repositories against vendor.sum, exiting if
+// any differ.
+func verifyRestored(w *workspace) {
+	checks, err := wgo.Verify(&w.Workspace, wgo.VerifyOptions{Log: os.Stderr})
+	orExit(err)
+	for _, sc := range checks {
+		if !sc.OK {
+			exit(1)
+		}
+	}
+}
+
+func parseJobs(s string) int {
+	jobs, err := strconv.Atoi(s)
+	if err != nil || jobs < 1 {
+		fmt.Fprintf(os.Stderr, "-j needs a positive number, not %q\n\n", s)
+		usage()
+	}
+	return jobs
+}
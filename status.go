@@ -0,0 +1,44 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/skelterjohn/wgo/wgo"
+)
+
+// status reports how the repositories on disk compare to the pins in
+// .gocfg/vendor.json, and exits non-zero if any of them have drifted.
+func status(w *workspace, args []string) {
+	if len(args) != 0 {
+		usage()
+	}
+	statuses, err := wgo.Status(&w.Workspace)
+	orExit(err)
+	drift := false
+	for _, s := range statuses {
+		if s.Drifted() {
+			drift = true
+		}
+		if jsonOutput {
+			emit(s)
+			continue
+		}
+		fmt.Println(s)
+	}
+	if drift {
+		exit(1)
+	}
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/skelterjohn/wgo/wgo"
+)
+
+// update moves pins forward: it advances each selected repository, checks
+// that the workspace still builds, and only then records the new revisions.
+func update(w *workspace, args []string) {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			fmt.Fprintf(os.Stderr, "unrecognized flag: %s\n\n", arg)
+			usage()
+		}
+	}
+	updated, err := wgo.Update(&w.Workspace, wgo.UpdateOptions{Specs: args, Log: os.Stderr})
+	orExit(err)
+	if len(updated) == 0 {
+		fmt.Fprintln(os.Stderr, "all pins are up to date")
+		return
+	}
+
+	for _, u := range updated {
+		if jsonOutput {
+			if u.ChangesErr != nil {
+				reportErrorAt(u.Dir, u.ChangesErr)
+			}
+			emit(u)
+			continue
+		}
+		fmt.Printf("%s: %s -> %s\n", u.Dir, wgo.ShortRev(u.From), wgo.ShortRev(u.To))
+		if u.ChangesErr != nil {
+			fmt.Fprintf(os.Stderr, "  %s\n", u.ChangesErr)
+			continue
+		}
+		for _, line := range u.Changes {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/skelterjohn/wgo/wgo"
+)
+
+// verify implements 'wgo verify'.
+func verify(w *workspace, args []string) {
+	for _, name := range args {
+		if strings.HasPrefix(name, "-") {
+			fmt.Fprintf(os.Stderr, "unrecognized flag: %s\n\n", name)
+			usage()
+		}
+	}
+	checks, err := wgo.Verify(&w.Workspace, wgo.VerifyOptions{Names: args, Log: os.Stderr})
+	orExit(err)
+	ok := true
+	for _, sc := range checks {
+		emit(sc)
+		ok = ok && sc.OK
+	}
+	if !ok {
+		exit(1)
+	}
+}
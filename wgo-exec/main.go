@@ -40,6 +40,8 @@ func main() {
 		os.Exit(1)
 	}
 
+	w.ApplyEnv()
+
 	path := os.Getenv("PATH")
 	gopath := w.Gopath(true)
 	sep := string(os.PathListSeparator)
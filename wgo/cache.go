@@ -0,0 +1,275 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/skelterjohn/wgo/workspaces"
+)
+
+// repoCache is a directory of bare mirrors, shared between workspaces, that
+// restore clones from instead of the network.
+type repoCache struct {
+	dir string
+	// offline forbids touching the network; only what is already cached
+	// can be restored.
+	offline bool
+
+	// locks serializes work on each mirror, since several pins may share
+	// one.
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func newRepoCache(dir string) *repoCache {
+	return &repoCache{
+		dir:   dir,
+		locks: map[string]*sync.Mutex{},
+	}
+}
+
+func (c *repoCache) lock(mirror string) *sync.Mutex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l, ok := c.locks[mirror]
+	if !ok {
+		l = &sync.Mutex{}
+		c.locks[mirror] = l
+	}
+	return l
+}
+
+// CacheDir is $WGO_CACHE, or wgo/repos in the user's cache directory.
+func CacheDir() string {
+	if dir := os.Getenv("WGO_CACHE"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "wgo", "repos")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".cache", "wgo", "repos")
+}
+
+// mirrorPath returns where the mirror of pin's repository lives. Mirrors are
+// keyed by URL, so every workspace pinning the same repository shares one.
+func (c *repoCache) mirrorPath(pin Pin) string {
+	key := pin.URL
+	if i := strings.Index(key, "://"); i >= 0 {
+		key = key[i+3:]
+	}
+	key = strings.TrimSuffix(strings.TrimSuffix(key, "/"), ".git")
+	key = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '/', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, key)
+	// Don't let a URL climb out of the cache.
+	var parts []string
+	for _, part := range strings.Split(key, "/") {
+		if part != "" && part != "." && part != ".." {
+			parts = append(parts, part)
+		}
+	}
+	return filepath.Join(c.dir, filepath.Join(parts...)+"."+pin.Type)
+}
+
+// ensure makes sure the mirror for pin exists and contains the pinned
+// revision, fetching from the network unless the cache is offline. It returns
+// the mirror's path.
+func (c *repoCache) ensure(pin Pin) (string, error) {
+	mirror := c.mirrorPath(pin)
+	l := c.lock(mirror)
+	l.Lock()
+	defer l.Unlock()
+
+	if _, err := os.Stat(mirror); err == nil {
+		if vcsHasRev(pin.Type, mirror, pin.Rev) {
+			return mirror, nil
+		}
+		if c.offline {
+			return "", fmt.Errorf("revision %s of %s is not in the cache", pin.Rev, pin.URL)
+		}
+		if err := mirrorUpdate(pin.Type, mirror); err != nil {
+			return "", err
+		}
+	} else {
+		if c.offline {
+			return "", fmt.Errorf("%s is not in the cache", pin.URL)
+		}
+		if err := os.MkdirAll(filepath.Dir(mirror), 0755); err != nil {
+			return "", err
+		}
+		if err := mirrorClone(pin.Type, pin.URL, mirror); err != nil {
+			return "", err
+		}
+	}
+	if !vcsHasRev(pin.Type, mirror, pin.Rev) {
+		return "", fmt.Errorf("revision %s not found in %s", pin.Rev, pin.URL)
+	}
+	return mirror, nil
+}
+
+func mirrorClone(kind, url, mirror string) error {
+	// Clone into a temporary name so an interrupted clone doesn't look like
+	// a mirror.
+	tmp := mirror + ".tmp"
+	os.RemoveAll(tmp)
+	var err error
+	switch kind {
+	case "git":
+		_, err = vcsOutput(filepath.Dir(mirror), "git", "clone", "--quiet", "--mirror", url, tmp)
+	case "hg":
+		_, err = vcsOutput(filepath.Dir(mirror), "hg", "clone", "--quiet", "-U", url, tmp)
+	default:
+		err = fmt.Errorf("unsupported VCS %q", kind)
+	}
+	if err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	return os.Rename(tmp, mirror)
+}
+
+func mirrorUpdate(kind, mirror string) error {
+	var err error
+	switch kind {
+	case "git":
+		_, err = vcsOutput(mirror, "git", "remote", "update", "--prune")
+	case "hg":
+		_, err = vcsOutput(mirror, "hg", "pull", "--quiet")
+	default:
+		err = fmt.Errorf("unsupported VCS %q", kind)
+	}
+	return err
+}
+
+// restoreFromCache checks out pin in dir, relative to the workspace root,
+// using only the local mirror. New checkouts are cloned from the mirror, which
+// hardlinks its objects, and then pointed back at the pinned URL. A checkout
+// that already has the pinned revision doesn't need the mirror at all.
+// progress is told when each stage starts.
+func (w *workspace) restoreFromCache(c *repoCache, dir string, pin Pin, progress func(state string)) error {
+	absDir := filepath.Join(w.Root, dir)
+	_, statErr := os.Stat(absDir)
+	if statErr == nil {
+		if kind := vcsKindOf(absDir); kind != pin.Type {
+			return fmt.Errorf("%s exists but is not a %s checkout", dir, pin.Type)
+		}
+	}
+
+	if statErr != nil || !vcsHasRev(pin.Type, absDir, pin.Rev) {
+		progress(RestoreFetching)
+		mirror, err := c.ensure(pin)
+		if err != nil {
+			return err
+		}
+		if os.IsNotExist(statErr) {
+			if err := os.MkdirAll(filepath.Dir(absDir), 0755); err != nil {
+				return err
+			}
+			if err := cloneFromMirror(pin, mirror, absDir); err != nil {
+				return err
+			}
+		} else if statErr != nil {
+			return statErr
+		} else if err := fetchFromMirror(pin.Type, mirror, absDir); err != nil {
+			return err
+		}
+	}
+	progress(RestoreCheckingOut)
+	return vcsCheckout(pin.Type, absDir, pin.Rev)
+}
+
+func cloneFromMirror(pin Pin, mirror, dir string) error {
+	switch pin.Type {
+	case "git":
+		if _, err := vcsOutput(filepath.Dir(dir), "git", "clone", "--quiet", "--no-checkout", mirror, dir); err != nil {
+			return err
+		}
+		_, err := vcsOutput(dir, "git", "remote", "set-url", "origin", pin.URL)
+		return err
+	case "hg":
+		if _, err := vcsOutput(filepath.Dir(dir), "hg", "clone", "--quiet", "-U", mirror, dir); err != nil {
+			return err
+		}
+		hgrc := fmt.Sprintf("[paths]\ndefault = %s\n", pin.URL)
+		return ioutil.WriteFile(filepath.Join(dir, ".hg", "hgrc"), []byte(hgrc), 0644)
+	}
+	return fmt.Errorf("unsupported VCS %q", pin.Type)
+}
+
+func fetchFromMirror(kind, mirror, dir string) error {
+	var err error
+	switch kind {
+	case "git":
+		_, err = vcsOutput(dir, "git", "fetch", "--quiet", mirror,
+			"+refs/heads/*:refs/remotes/origin/*", "+refs/tags/*:refs/tags/*")
+	case "hg":
+		_, err = vcsOutput(dir, "hg", "pull", "--quiet", mirror)
+	default:
+		err = fmt.Errorf("unsupported VCS %q", kind)
+	}
+	return err
+}
+
+func vcsCheckout(kind, dir, rev string) error {
+	var err error
+	switch kind {
+	case "git":
+		_, err = vcsOutput(dir, "git", "-c", "advice.detachedHead=false", "checkout", "--quiet", rev)
+	case "hg":
+		_, err = vcsOutput(dir, "hg", "update", "--quiet", "-r", rev)
+	default:
+		err = fmt.Errorf("unsupported VCS %q", kind)
+	}
+	return err
+}
+
+// CachedRepo is a repository that FillCache made sure is cached.
+type CachedRepo struct {
+	Dir string
+	URL string
+}
+
+// FillCache fetches every repository pinned in .gocfg/vendor.json into the
+// repository cache, in CacheDir, so that later restores work offline.
+// Repositories that fail are reported in an Errors of ItemErrors.
+func FillCache(w *workspaces.Workspace) ([]CachedRepo, error) {
+	ws := wrap(w, nil)
+	c := newRepoCache(CacheDir())
+	cfg, err := ws.loadVendorConfig()
+	if err != nil {
+		return nil, err
+	}
+	var cached []CachedRepo
+	var errs []error
+	for _, dir := range cfg.dirs() {
+		if _, err := c.ensure(cfg[dir]); err != nil {
+			errs = append(errs, &ItemError{Item: dir, Err: err})
+			continue
+		}
+		cached = append(cached, CachedRepo{Dir: dir, URL: cfg[dir].URL})
+	}
+	return cached, errorsOrNil(errs)
+}
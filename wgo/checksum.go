@@ -0,0 +1,355 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/skelterjohn/wgo/workspaces"
+)
+
+// treeSum is the recorded contents of one pinned repository.
+type treeSum struct {
+	// Hash covers every file path and content in the tree.
+	Hash string
+	// Files maps slash separated paths, relative to the repository root, to
+	// the hashes of their contents.
+	Files map[string]string
+}
+
+// vendorSums maps pinned repository directories, as in vendor.json, to their
+// tree sums. It is stored in .gocfg/vendor.sum.
+type vendorSums map[string]treeSum
+
+// vcsMetadataDirs are never part of a tree's hash.
+var vcsMetadataDirs = map[string]bool{
+	".git": true,
+	".hg":  true,
+	".svn": true,
+	".bzr": true,
+}
+
+func (w *workspace) vendorSumsPath() string {
+	return filepath.Join(w.Root, workspaces.ConfigDirName, "vendor.sum")
+}
+
+func (w *workspace) loadVendorSums() (vendorSums, error) {
+	sums := vendorSums{}
+	data, err := ioutil.ReadFile(w.vendorSumsPath())
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &sums); err != nil {
+		return nil, fmt.Errorf("%s: %v", w.vendorSumsPath(), err)
+	}
+	return sums, nil
+}
+
+// write replaces .gocfg/vendor.sum with sums.
+func (sums vendorSums) write(w *workspace) error {
+	data, err := json.MarshalIndent(sums, "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	tmp := w.vendorSumsPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.vendorSumsPath())
+}
+
+// sumTree hashes the files in the pinned repository dir: the files its VCS
+// tracks, if it is a checkout, or else every file. Other pinned repositories
+// and checkouts nested inside it are left out, since they are restored
+// separately.
+func (w *workspace) sumTree(cfg vendorConfig, dir string) (treeSum, error) {
+	root := filepath.Join(w.Root, dir)
+	if kind := vcsKindOf(root); kind != "" {
+		return w.sumTracked(cfg, root, kind)
+	}
+	ts := treeSum{Files: map[string]string{}}
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if path != root && w.isNestedRepo(cfg, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		sum, err := hashFile(path, fi)
+		if err != nil {
+			return err
+		}
+		ts.Files[filepath.ToSlash(rel)] = sum
+		return nil
+	})
+	if err != nil {
+		return treeSum{}, err
+	}
+	ts.Hash = ts.treeHash()
+	return ts, nil
+}
+
+// sumTracked hashes the files that the checkout at root tracks, as they are on
+// disk, so that build outputs and other untracked files don't count. Tracked
+// files that have been deleted are left out.
+func (w *workspace) sumTracked(cfg vendorConfig, root, kind string) (treeSum, error) {
+	files, err := vcsTrackedFiles(kind, root)
+	if err != nil {
+		return treeSum{}, err
+	}
+	ts := treeSum{Files: map[string]string{}}
+	nested := map[string]bool{}
+	inNested := func(path string) bool {
+		for dir := filepath.Dir(path); dir != root && withinDir(root, dir); dir = filepath.Dir(dir) {
+			n, ok := nested[dir]
+			if !ok {
+				n = w.isNestedRepo(cfg, dir)
+				nested[dir] = n
+			}
+			if n {
+				return true
+			}
+		}
+		return false
+	}
+	for _, rel := range files {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if inNested(path) {
+			continue
+		}
+		fi, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return treeSum{}, err
+		}
+		if fi.IsDir() {
+			// A submodule, which is a nested checkout.
+			continue
+		}
+		sum, err := hashFile(path, fi)
+		if err != nil {
+			return treeSum{}, err
+		}
+		ts.Files[rel] = sum
+	}
+	ts.Hash = ts.treeHash()
+	return ts, nil
+}
+
+// isNestedRepo reports whether dir, inside a pinned repository, is left out of
+// its sum: VCS metadata, another pinned repository, or another checkout.
+func (w *workspace) isNestedRepo(cfg vendorConfig, dir string) bool {
+	if vcsMetadataDirs[filepath.Base(dir)] {
+		return true
+	}
+	if rel, err := filepath.Rel(w.Root, dir); err == nil {
+		if _, ok := cfg[rel]; ok {
+			return true
+		}
+	}
+	return vcsKindOf(dir) != ""
+}
+
+// hashFile hashes a file's contents, or a symlink's target.
+func hashFile(path string, fi os.FileInfo) (string, error) {
+	h := sha256.New()
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		io.WriteString(h, "symlink "+target)
+	} else if fi.Mode().IsRegular() {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	} else {
+		return "", fmt.Errorf("%s is not a regular file", path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// treeHash hashes the sorted list of file hashes and paths.
+func (ts treeSum) treeHash() string {
+	var paths []string
+	for path := range ts.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	h := sha256.New()
+	for _, path := range paths {
+		fmt.Fprintf(h, "%s  %s\n", ts.Files[path], path)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// diff lists how got differs from the recorded ts, one line per file.
+func (ts treeSum) diff(got treeSum) []string {
+	var problems []string
+	for path, sum := range ts.Files {
+		gotSum, ok := got.Files[path]
+		switch {
+		case !ok:
+			problems = append(problems, path+": missing")
+		case gotSum != sum:
+			problems = append(problems, path+": modified")
+		}
+	}
+	for path := range got.Files {
+		if _, ok := ts.Files[path]; !ok {
+			problems = append(problems, path+": added")
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// sumVendorConfig computes the tree sum of every repository pinned in cfg.
+func (w *workspace) sumVendorConfig(cfg vendorConfig) (vendorSums, error) {
+	sums := vendorSums{}
+	for _, dir := range cfg.dirs() {
+		ts, err := w.sumTree(cfg, dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", dir, err)
+		}
+		sums[dir] = ts
+	}
+	return sums, nil
+}
+
+// updateVendorSums re-records the sums of dirs, if the workspace keeps a
+// vendor.sum at all.
+func (w *workspace) updateVendorSums(cfg vendorConfig, dirs []string) error {
+	sums, err := w.loadVendorSums()
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		ts, err := w.sumTree(cfg, dir)
+		if err != nil {
+			return fmt.Errorf("%s: %v", dir, err)
+		}
+		sums[dir] = ts
+	}
+	return sums.write(w)
+}
+
+// SumCheck is the result of checking one repository against vendor.sum.
+type SumCheck struct {
+	Dir string
+	OK  bool
+	// Problems say how the repository differs, one file per line.
+	Problems []string `json:",omitempty"`
+}
+
+// VerifyOptions control Verify.
+type VerifyOptions struct {
+	// Names are the repositories to check, by directory or import path; all
+	// of them if empty.
+	Names []string
+	// Log gets a description of every mismatch.
+	Log io.Writer
+}
+
+// Verify compares the repositories pinned in .gocfg/vendor.json with the
+// checksums in .gocfg/vendor.sum, and returns the result for each. A mismatch
+// is not an error; check OK.
+func Verify(w *workspaces.Workspace, opts VerifyOptions) ([]SumCheck, error) {
+	ws := wrap(w, opts.Log)
+	cfg, err := ws.loadVendorConfig()
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, name := range opts.Names {
+		dir, ok := ws.findPin(cfg, name)
+		if !ok {
+			return nil, fmt.Errorf("%q is not pinned in %s", name, ws.vendorConfigPath())
+		}
+		dirs = append(dirs, dir)
+	}
+	return ws.verifyVendorSums(dirs)
+}
+
+// verifyVendorSums compares the given pinned repositories, or all of them if
+// dirs is empty, with vendor.sum, and logs every mismatch.
+func (w *workspace) verifyVendorSums(dirs []string) ([]SumCheck, error) {
+	cfg, err := w.loadVendorConfig()
+	if err != nil {
+		return nil, err
+	}
+	sums, err := w.loadVendorSums()
+	if err != nil {
+		return nil, err
+	}
+	if len(dirs) == 0 {
+		dirs = cfg.dirs()
+	}
+	var checks []SumCheck
+	for _, dir := range dirs {
+		sc := SumCheck{Dir: dir}
+		want, found := sums[dir]
+		if !found {
+			sc.Problems = []string{"no checksum in " + w.vendorSumsPath()}
+			w.logf("%s: %s\n", dir, sc.Problems[0])
+			checks = append(checks, sc)
+			continue
+		}
+		got, err := w.sumTree(cfg, dir)
+		if err != nil {
+			sc.Problems = []string{err.Error()}
+			w.logf("%s: %s\n", dir, err)
+			checks = append(checks, sc)
+			continue
+		}
+		if got.Hash == want.Hash {
+			sc.OK = true
+			checks = append(checks, sc)
+			continue
+		}
+		sc.Problems = want.diff(got)
+		w.logf("%s: checksum mismatch\n", dir)
+		for _, problem := range sc.Problems {
+			w.logf("  %s\n", problem)
+		}
+		checks = append(checks, sc)
+	}
+	return checks, nil
+}
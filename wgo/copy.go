@@ -0,0 +1,326 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultCopySkip are never copied: VCS metadata and go build outputs.
+var defaultCopySkip = []string{
+	".git", ".hg", ".svn", ".bzr",
+	"_obj", "_test", "*.test", "*.exe", "*.prof",
+}
+
+// copyOptions control copyDir.
+type copyOptions struct {
+	// Skip lists glob patterns of files and directories to leave out. A
+	// pattern matches either the base name or the slash separated path
+	// relative to the source directory.
+	Skip []string
+	// RejectEscapingLinks makes symlinks that point outside the source
+	// directory an error, rather than copying them as they are.
+	RejectEscapingLinks bool
+	// Link is how regular files are copied; one of the Link modes. The
+	// zero value copies.
+	Link string
+}
+
+// Ways of copying regular files, for VendorOptions.Link.
+const (
+	LinkCopy    = "copy"
+	LinkHard    = "hard"
+	LinkReflink = "reflink"
+	// LinkAuto tries a reflink, then a hardlink, then copies.
+	LinkAuto = "auto"
+)
+
+// ValidLinkMode reports whether mode is one of the Link modes.
+func ValidLinkMode(mode string) bool {
+	switch mode {
+	case LinkCopy, LinkHard, LinkReflink, LinkAuto:
+		return true
+	}
+	return false
+}
+
+// CopyStats counts how Vendor copied regular files.
+type CopyStats struct {
+	Copied, Hardlinked, Reflinked int
+	// Bytes is the size of all the regular files.
+	Bytes int64
+	// Saved is the size of the files that were linked rather than copied.
+	Saved int64
+}
+
+func (cs *CopyStats) add(o CopyStats) {
+	cs.Copied += o.Copied
+	cs.Hardlinked += o.Hardlinked
+	cs.Reflinked += o.Reflinked
+	cs.Bytes += o.Bytes
+	cs.Saved += o.Saved
+}
+
+func (cs CopyStats) String() string {
+	return fmt.Sprintf("copied %d files, hardlinked %d, reflinked %d; saved %s",
+		cs.Copied, cs.Hardlinked, cs.Reflinked, FormatBytes(cs.Saved))
+}
+
+// FormatBytes formats n as a size, like "1.5 MiB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// copyOptions returns the options vendoring uses in this workspace.
+func (w *workspace) copyOptions() copyOptions {
+	return copyOptions{
+		Skip:                append(append([]string(nil), defaultCopySkip...), w.VendorSkip...),
+		RejectEscapingLinks: w.VendorRejectEscapingLinks,
+	}
+}
+
+func (opts copyOptions) skip(rel, name string) bool {
+	for _, pattern := range opts.Skip {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// copyDir copies the tree at src to dst. The copy is made in a temporary
+// directory next to dst and renamed into place only if everything was
+// copied, replacing anything already at dst. Symlinks within src are copied
+// as symlinks, and modification times are kept. It returns every error
+// encountered.
+func copyDir(src, dst string, opts copyOptions) (CopyStats, []error) {
+	var stats CopyStats
+	// filepath.Walk doesn't follow a symlink at its root, so resolve it.
+	src, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return stats, []error{err}
+	}
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return stats, []error{err}
+	}
+	if !srcInfo.IsDir() {
+		return stats, []error{fmt.Errorf("%s is not a directory", src)}
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return stats, []error{err}
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp")
+	if err != nil {
+		return stats, []error{err}
+	}
+
+	var errs []error
+	// Directory modes and times are set last, since filling a directory
+	// changes its modification time and may need write permission.
+	type dirAttrs struct {
+		path  string
+		mode  os.FileMode
+		mtime time.Time
+	}
+	var dirs []dirAttrs
+
+	filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		if rel != "." && opts.skip(filepath.ToSlash(rel), info.Name()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		dstPath := filepath.Join(tmp, rel)
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			if err := os.MkdirAll(dstPath, 0755); err != nil {
+				errs = append(errs, err)
+				return filepath.SkipDir
+			}
+			dirs = append(dirs, dirAttrs{dstPath, mode.Perm(), info.ModTime()})
+		case mode&os.ModeSymlink != 0:
+			if err := copySymlink(src, p, dstPath, opts); err != nil {
+				errs = append(errs, err)
+			}
+		case mode.IsRegular():
+			how, err := linkFile(opts.Link, info, p, dstPath)
+			if err != nil {
+				errs = append(errs, err)
+				return nil
+			}
+			stats.Bytes += info.Size()
+			switch how {
+			case LinkHard:
+				// The link shares the source's inode, times and all.
+				stats.Hardlinked++
+				stats.Saved += info.Size()
+				return nil
+			case LinkReflink:
+				stats.Reflinked++
+				stats.Saved += info.Size()
+			default:
+				stats.Copied++
+			}
+			if err := os.Chtimes(dstPath, info.ModTime(), info.ModTime()); err != nil {
+				errs = append(errs, err)
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s: cannot copy %s", p, mode.Type()))
+		}
+		return nil
+	})
+
+	if len(errs) != 0 {
+		os.RemoveAll(tmp)
+		return CopyStats{}, errs
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		d := dirs[i]
+		if err := os.Chmod(d.path, d.mode); err != nil {
+			errs = append(errs, err)
+		}
+		if err := os.Chtimes(d.path, d.mtime, d.mtime); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		if err := replaceDir(tmp, dst); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 0 {
+		os.RemoveAll(tmp)
+		return CopyStats{}, errs
+	}
+	return stats, nil
+}
+
+// linkFile puts the regular file src at dst the way mode asks, falling back
+// to copying if that is not possible. It returns how the file was copied.
+func linkFile(mode string, finfo os.FileInfo, src, dst string) (string, error) {
+	if mode == LinkReflink || mode == LinkAuto {
+		if reflinkFile(finfo, src, dst) == nil {
+			return LinkReflink, nil
+		}
+	}
+	if mode == LinkHard || mode == LinkAuto {
+		if os.Link(src, dst) == nil {
+			return LinkHard, nil
+		}
+	}
+	return LinkCopy, copyFile(finfo, src, dst)
+}
+
+// copyError combines the errors from copyDir into one, or nil.
+func copyError(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Errorf("%d errors copying:\n\t%s", len(errs), strings.Join(msgs, "\n\t"))
+}
+
+// copySymlink recreates the symlink at p, within the tree at root, as dst.
+func copySymlink(root, p, dst string, opts copyOptions) error {
+	target, err := os.Readlink(p)
+	if err != nil {
+		return err
+	}
+	if opts.RejectEscapingLinks {
+		resolved := target
+		if !filepath.IsAbs(resolved) {
+			resolved = filepath.Join(filepath.Dir(p), target)
+		}
+		if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s: symlink to %s leaves %s", p, target, root)
+		}
+	}
+	return os.Symlink(target, dst)
+}
+
+// replaceDir renames tmp to dst, moving any existing dst out of the way
+// first and putting it back if the rename fails.
+func replaceDir(tmp, dst string) error {
+	if _, err := os.Lstat(dst); os.IsNotExist(err) {
+		return os.Rename(tmp, dst)
+	}
+	old := tmp + ".old"
+	if err := os.Rename(dst, old); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Rename(old, dst)
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+func copyFile(finfo os.FileInfo, src, dst string) error {
+	fin, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer fin.Close()
+
+	fout, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, finfo.Mode())
+	if err != nil {
+		return err
+	}
+	defer fout.Close()
+
+	if _, err = io.Copy(fout, fin); err != nil {
+		return err
+	}
+	if err = fout.Close(); err != nil {
+		return err
+	}
+	return fin.Close()
+}
@@ -0,0 +1,24 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import "os"
+
+// isCrossDevice reports whether err is a rename failing because its source
+// and destination are on different devices. Plan 9 has no error number for
+// that, so any failed rename is retried as a copy.
+func isCrossDevice(err error) bool {
+	_, ok := err.(*os.LinkError)
+	return ok
+}
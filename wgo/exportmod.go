@@ -0,0 +1,432 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skelterjohn/wgo/workspaces"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// exportGoVersion is the go directive of exported go.mod files. From Go 1.14
+// on, the go tool checks vendor/modules.txt against go.mod, using the
+// "## explicit" markers that writeModulesVendor writes.
+const exportGoVersion = "1.14"
+
+// ExportModulesOptions control ExportModules.
+type ExportModulesOptions struct {
+	// Vendor also fills a vendor directory next to each go.mod.
+	Vendor bool
+	// Force overwrites existing go.mod files. Otherwise they are skipped.
+	Force bool
+	Log   io.Writer
+}
+
+// ExportedModule is a go.mod file written by ExportModules.
+type ExportedModule struct {
+	// Path is relative to the workspace root.
+	Path   string
+	Module string
+}
+
+// ExportModules writes a go.mod file for each package tree in the
+// workspace's own src directory, so the code can be consumed in module mode.
+// Pinned repositories are required at their pinned revisions. Imports that
+// aren't pinned are left out of the go.mod files; they are reported in an
+// Errors, along with the files that were written.
+func ExportModules(w *workspaces.Workspace, opts ExportModulesOptions) ([]ExportedModule, error) {
+	ws := wrap(w, opts.Log)
+	cfg, err := ws.loadVendorConfig()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// Pinned repositories are required at the pinned revision, converted into
+	// a module version.
+	pinned := map[string]module.Version{}
+	for _, dir := range cfg.dirs() {
+		mv, err := ws.pinModule(dir, cfg[dir])
+		if err != nil {
+			ws.logf("for %q: %s\n", dir, err)
+			continue
+		}
+		pinned[filepath.Join(ws.Root, dir)] = mv
+	}
+
+	srcDir := filepath.Join(ws.Root, "src")
+	pinDirs := map[string]bool{}
+	for _, dir := range cfg.dirs() {
+		pinDirs[filepath.Join(ws.Root, dir)] = true
+	}
+	trees := findPackageTrees(srcDir, pinDirs)
+	if len(trees) == 0 {
+		return nil, fmt.Errorf("no package trees found in %q", srcDir)
+	}
+
+	var exported []ExportedModule
+	var errs []error
+	for _, tree := range trees {
+		modPath := filepath.ToSlash(tree)
+		treeDir := filepath.Join(srcDir, tree)
+		gomodPath := filepath.Join(treeDir, "go.mod")
+		if _, err := os.Stat(gomodPath); err == nil && !opts.Force {
+			ws.logf("%q already exists; use --force to overwrite it\n", gomodPath)
+			continue
+		}
+
+		deps, err := ws.listDeps([]string{"./" + filepath.Join("src", tree) + "/..."}, []Platform{{}})
+		if err != nil {
+			return exported, err
+		}
+
+		requires := map[string]module.Version{}
+		replaces := map[string]string{}
+		modPkgs := map[string][]string{}
+		modDirs := map[string]string{}
+		for pkg, dir := range deps {
+			if withinDir(treeDir, dir) {
+				continue
+			}
+			if sibling := treeContaining(srcDir, trees, dir); sibling != "" {
+				sibPath := filepath.ToSlash(sibling)
+				rel, err := filepath.Rel(treeDir, filepath.Join(srcDir, sibling))
+				if err != nil {
+					return exported, err
+				}
+				requires[sibPath] = module.Version{Path: sibPath, Version: "v0.0.0"}
+				replaces[sibPath] = filepath.ToSlash(rel)
+				modPkgs[sibPath] = append(modPkgs[sibPath], pkg)
+				modDirs[pkg] = dir
+				continue
+			}
+			// With nested pins, the package belongs to the innermost one.
+			pinDir := ""
+			for d := range pinned {
+				if withinDir(d, dir) && len(d) > len(pinDir) {
+					pinDir = d
+				}
+			}
+			if pinDir != "" {
+				mv := pinned[pinDir]
+				requires[mv.Path] = mv
+				modPkgs[mv.Path] = append(modPkgs[mv.Path], pkg)
+				modDirs[pkg] = dir
+			} else {
+				errs = append(errs, &ItemError{Item: modPath, Err: fmt.Errorf("%q is not pinned in %s", pkg, ws.vendorConfigPath())})
+			}
+		}
+
+		mf := &modfile.File{}
+		if err := mf.AddModuleStmt(modPath); err != nil {
+			return exported, err
+		}
+		if err := mf.AddGoStmt(exportGoVersion); err != nil {
+			return exported, err
+		}
+		for _, p := range sortedModulePaths(requires) {
+			mv := requires[p]
+			mf.AddNewRequire(mv.Path, mv.Version, false)
+		}
+		for _, p := range sortedModulePaths(requires) {
+			if r, ok := replaces[p]; ok {
+				if err := mf.AddReplace(p, "", r, ""); err != nil {
+					return exported, err
+				}
+			}
+		}
+		mf.Cleanup()
+		data, err := mf.Format()
+		if err != nil {
+			return exported, err
+		}
+		if err := ioutil.WriteFile(gomodPath, data, 0644); err != nil {
+			return exported, err
+		}
+		if rel, err := filepath.Rel(ws.Root, gomodPath); err == nil {
+			exported = append(exported, ExportedModule{Path: rel, Module: modPath})
+		}
+
+		if opts.Vendor {
+			if err := writeModulesVendor(treeDir, requires, replaces, modPkgs, modDirs); err != nil {
+				return exported, err
+			}
+		}
+	}
+	return exported, errorsOrNil(errs)
+}
+
+// writeModulesVendor populates treeDir/vendor with the packages the tree
+// imports, and describes them in vendor/modules.txt.
+func writeModulesVendor(treeDir string, requires map[string]module.Version, replaces map[string]string, modPkgs map[string][]string, modDirs map[string]string) error {
+	vendorDir := filepath.Join(treeDir, "vendor")
+	var buf bytes.Buffer
+	for _, p := range sortedModulePaths(requires) {
+		mv := requires[p]
+		if r, ok := replaces[p]; ok {
+			fmt.Fprintf(&buf, "# %s %s => %s\n", mv.Path, mv.Version, r)
+		} else {
+			fmt.Fprintf(&buf, "# %s %s\n", mv.Path, mv.Version)
+		}
+		fmt.Fprintln(&buf, "## explicit")
+		pkgs := modPkgs[p]
+		sort.Strings(pkgs)
+		for _, pkg := range pkgs {
+			fmt.Fprintln(&buf, pkg)
+			if err := copyPackageFiles(modDirs[pkg], filepath.Join(vendorDir, filepath.FromSlash(pkg))); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.MkdirAll(vendorDir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(vendorDir, "modules.txt"), buf.Bytes(), 0644)
+}
+
+// copyPackageFiles copies the regular files of a single package directory,
+// without descending into subpackages.
+func copyPackageFiles(src, dst string) error {
+	infos, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		dstPath := filepath.Join(dst, info.Name())
+		os.Remove(dstPath)
+		if err := copyFile(info, filepath.Join(src, info.Name()), dstPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pinModule works out the module path and version for a pinned repository.
+func (w *workspace) pinModule(dir string, pin Pin) (module.Version, error) {
+	absDir := filepath.Join(w.Root, dir)
+	var mv module.Version
+
+	// The module path is the repository's import path, unless the repository
+	// declares its own.
+	for _, gopath := range w.Gopaths {
+		src := filepath.Join(w.Root, gopath, "src")
+		if rel, err := filepath.Rel(src, absDir); err == nil && !strings.HasPrefix(rel, "..") {
+			mv.Path = filepath.ToSlash(rel)
+			break
+		}
+	}
+	if mf, err := loadGomod(absDir); err == nil && mf.Module != nil {
+		mv.Path = mf.Module.Mod.Path
+	}
+	if mv.Path == "" {
+		return mv, fmt.Errorf("not in a workspace gopath")
+	}
+
+	kind := pin.Type
+	if kind == "" {
+		kind = vcsKindOf(absDir)
+	}
+	version, err := revModuleVersion(kind, absDir, pin.Rev, mv.Path)
+	if err != nil {
+		return mv, err
+	}
+	mv.Version = version
+	return mv, nil
+}
+
+// revModuleVersion finds the module version for rev: a semver tag pointing
+// directly at it if there is one, or a pseudo-version otherwise.
+func revModuleVersion(kind, dir, rev, modPath string) (string, error) {
+	_, pathMajor, _ := module.SplitPathVersion(modPath)
+	major := strings.TrimLeft(pathMajor, "/.")
+
+	fits := func(tag string) bool {
+		if !semver.IsValid(tag) {
+			return false
+		}
+		if major == "" {
+			m := semver.Major(tag)
+			return m == "v0" || m == "v1"
+		}
+		return semver.Major(tag) == major
+	}
+
+	tags, err := vcsTagsAt(kind, dir, rev)
+	if err != nil {
+		return "", err
+	}
+	best := ""
+	for _, tag := range tags {
+		if fits(tag) && (best == "" || semver.Compare(tag, best) > 0) {
+			best = tag
+		}
+	}
+	if best != "" {
+		return best, nil
+	}
+
+	full, err := vcsResolveRev(kind, dir, rev)
+	if err != nil {
+		return "", err
+	}
+	t, err := vcsRevTime(kind, dir, full)
+	if err != nil {
+		return "", err
+	}
+	older := ""
+	if tag, err := vcsPreviousTag(kind, dir, full); err == nil && fits(tag) {
+		older = tag
+	}
+	return module.PseudoVersion(major, older, t, ShortRev(full)), nil
+}
+
+func vcsTagsAt(kind, dir, rev string) ([]string, error) {
+	var out string
+	var err error
+	switch kind {
+	case "git":
+		out, err = vcsOutput(dir, "git", "tag", "--points-at", rev)
+	case "hg":
+		out, err = vcsOutput(dir, "hg", "log", "-r", rev, "--template", "{join(tags, '\\n')}")
+	default:
+		return nil, fmt.Errorf("unsupported VCS %q", kind)
+	}
+	if err != nil || out == "" {
+		return nil, err
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+func vcsResolveRev(kind, dir, rev string) (string, error) {
+	switch kind {
+	case "git":
+		return vcsOutput(dir, "git", "rev-parse", rev+"^{commit}")
+	case "hg":
+		return vcsOutput(dir, "hg", "log", "-r", rev, "--template", "{node}")
+	}
+	return "", fmt.Errorf("unsupported VCS %q", kind)
+}
+
+func vcsRevTime(kind, dir, rev string) (time.Time, error) {
+	var out string
+	var err error
+	switch kind {
+	case "git":
+		out, err = vcsOutput(dir, "git", "log", "-1", "--format=%ct", rev)
+	case "hg":
+		out, err = vcsOutput(dir, "hg", "log", "-r", rev, "--template", "{date|hgdate}")
+	default:
+		return time.Time{}, fmt.Errorf("unsupported VCS %q", kind)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return time.Time{}, fmt.Errorf("no date for %q", rev)
+	}
+	secs, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(secs, 0).UTC(), nil
+}
+
+// vcsPreviousTag returns the most recent tag reachable from rev.
+func vcsPreviousTag(kind, dir, rev string) (string, error) {
+	switch kind {
+	case "git":
+		return vcsOutput(dir, "git", "describe", "--tags", "--abbrev=0", rev)
+	case "hg":
+		return vcsOutput(dir, "hg", "log", "-r", rev, "--template", "{latesttag}")
+	}
+	return "", fmt.Errorf("unsupported VCS %q", kind)
+}
+
+// findPackageTrees returns the roots of the package trees in srcDir, relative
+// to it. A tree root is the shallowest directory that is a repository, is
+// pinned in pinDirs, or already has a go.mod. Directories with Go files that
+// aren't inside any such root are roots of their own.
+func findPackageTrees(srcDir string, pinDirs map[string]bool) []string {
+	var trees []string
+	filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() || path == srcDir {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") || strings.HasPrefix(info.Name(), "_") {
+			return filepath.SkipDir
+		}
+		isRoot := vcsKindOf(path) != "" || pinDirs[path]
+		if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+			isRoot = true
+		}
+		if !isRoot {
+			// The walk stops at roots, so a package found here has no
+			// repository around it. A directory that merely holds
+			// others, like src/github.com, is never a root.
+			matches, _ := filepath.Glob(filepath.Join(path, "*.go"))
+			isRoot = len(matches) != 0
+		}
+		if isRoot {
+			if rel, err := filepath.Rel(srcDir, path); err == nil {
+				trees = append(trees, rel)
+			}
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return trees
+}
+
+// treeContaining returns the tree in srcDir that dir belongs to, if any.
+func treeContaining(srcDir string, trees []string, dir string) string {
+	for _, tree := range trees {
+		if withinDir(filepath.Join(srcDir, tree), dir) {
+			return tree
+		}
+	}
+	return ""
+}
+
+// withinDir reports whether path is dir or one of its descendants.
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func sortedModulePaths(m map[string]module.Version) []string {
+	var paths []string
+	for p := range m {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
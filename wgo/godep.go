@@ -0,0 +1,169 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/vcs"
+)
+
+// Godeps is the part of a godep Godeps.json file that wgo reads.
+type Godeps struct {
+	Deps []Dependency
+}
+
+// Dependency is one repository that a Godeps.json or other lock file pins to
+// a revision, named by an import path within it.
+type Dependency struct {
+	ImportPath string
+	Rev        string
+
+	// Repo and VCS are set by lock file formats that record where the
+	// repository lives, rather than leaving it to the import path.
+	Repo string `json:"-"`
+	VCS  string `json:"-"`
+}
+
+func (w *workspace) importGodeps() []dirDep {
+	dirGs := map[string]Godeps{}
+	scanDir := func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if g, err := loadGodepsConfig(path); err == nil {
+			dirGs[path] = g
+		}
+		return nil
+	}
+	filepath.Walk(w.Root, scanDir)
+
+	// Go through the directories in order, so that the first pin, as
+	// mergeGodeps keeps it, is the same from run to run.
+	var dirs []string
+	for dir := range dirGs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	var dds []dirDep
+	for _, dir := range dirs {
+		for _, dep := range dirGs[dir].Deps {
+			dd, err := w.resolveDependency(dir, dep)
+			if err != nil {
+				w.logf("for %q: %s\n", dep.ImportPath, err)
+				continue
+			}
+			dds = append(dds, dd)
+		}
+	}
+	return dds
+}
+
+func loadGodepsConfig(dir string) (Godeps, error) {
+	var g Godeps
+
+	configPath := filepath.Join(dir, "Godeps", "Godeps.json")
+	fin, err := os.Open(configPath)
+	if err != nil {
+		return g, err
+	}
+	return g, json.NewDecoder(fin).Decode(&g)
+}
+
+type dirDep struct {
+	srcDir string
+	repo   string
+	rev    string
+	root   string
+	kind   string
+}
+
+func (w *workspace) newDirDep(srcDir string, repoRoot *vcs.RepoRoot, rev string) dirDep {
+	return dirDep{
+		srcDir: srcDir,
+		rev:    rev,
+		repo:   repoRoot.Repo,
+		root:   filepath.Join(w.vendorRootSrc(), repoRoot.Root),
+		kind:   repoRoot.VCS.Cmd,
+	}
+}
+
+// resolveDependency finds the repository that dep's import path belongs to.
+func (w *workspace) resolveDependency(srcDir string, dep Dependency) (dirDep, error) {
+	repoRoot, err := vcs.RepoRootForImportPath(dep.ImportPath, false)
+	if err != nil {
+		if dep.Repo == "" {
+			return dirDep{}, err
+		}
+		// The lock file says where the repository is, so the import path
+		// only has to tell us where it goes.
+		repoRoot = &vcs.RepoRoot{
+			Root: dep.ImportPath,
+			VCS:  vcs.ByCmd("git"),
+		}
+	}
+	dd := w.newDirDep(srcDir, repoRoot, dep.Rev)
+	if dep.Repo != "" {
+		dd.repo = dep.Repo
+	}
+	if dep.VCS != "" {
+		dd.kind = dep.VCS
+	}
+	return dd, nil
+}
+
+// sameRepoRev reports whether two dirDeps pin the same repository at the same
+// revision, regardless of where the pins were found.
+func (dd dirDep) sameRepoRev(o dirDep) bool {
+	return dd.repo == o.repo && SameRev(dd.rev, o.rev) && dd.root == o.root && dd.kind == o.kind
+}
+
+// mergeGodeps will get one master list of revs.
+func (w *workspace) mergeGodeps(dds []dirDep) map[string]dirDep {
+	roots := map[string]dirDep{}
+	for _, dd := range dds {
+		if orig, ok := roots[dd.root]; ok {
+			if !orig.sameRepoRev(dd) {
+				w.logf("conflict for %q: pins in %q and %q do not match\n",
+					dd.repo, orig.srcDir, dd.srcDir)
+			}
+			continue
+		}
+		roots[dd.root] = dd
+	}
+
+	// clear out nested
+	var rootDirs sort.StringSlice
+	for _, dd := range roots {
+		rootDirs = append(rootDirs, dd.root)
+	}
+	sort.Sort(rootDirs)
+
+	var last string
+	for _, r := range rootDirs {
+		if last != "" && strings.HasPrefix(r, last) {
+			delete(roots, r)
+			w.logf("ignoring %q which is managed in %q\n", r, last)
+		} else {
+			last = r + string(filepath.Separator)
+		}
+	}
+
+	return roots
+}
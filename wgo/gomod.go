@@ -0,0 +1,178 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/tools/go/vcs"
+)
+
+// importGomods collects revision pins from the require and replace directives
+// of every go.mod file in the workspace.
+func (w *workspace) importGomods() []dirDep {
+	var dds []dirDep
+	scanDir := func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		mf, err := loadGomod(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				w.logf("%s\n", err)
+			}
+			return nil
+		}
+		dds = append(dds, w.gomodDirDeps(path, mf)...)
+		return nil
+	}
+	filepath.Walk(w.Root, scanDir)
+	return dds
+}
+
+func loadGomod(dir string) (*modfile.File, error) {
+	configPath := filepath.Join(dir, "go.mod")
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return modfile.Parse(configPath, data, nil)
+}
+
+// gomodDirDeps turns the requirements of one go.mod file into dirDeps,
+// following replace directives.
+func (w *workspace) gomodDirDeps(dir string, mf *modfile.File) []dirDep {
+	replaced := map[module.Version]module.Version{}
+	for _, r := range mf.Replace {
+		replaced[r.Old] = r.New
+	}
+	replacement := func(mv module.Version) (module.Version, bool) {
+		if r, ok := replaced[mv]; ok {
+			return r, true
+		}
+		// A replace without a version applies to every version.
+		r, ok := replaced[module.Version{Path: mv.Path}]
+		return r, ok
+	}
+
+	var dds []dirDep
+	for _, req := range mf.Require {
+		mv := req.Mod
+		if r, ok := replacement(mv); ok {
+			if r.Version == "" {
+				// The replacement is a local directory.
+				localDir := r.Path
+				if !filepath.IsAbs(localDir) {
+					localDir = filepath.Join(dir, localDir)
+				}
+				dd, err := w.localDirDep(dir, mv.Path, localDir)
+				if err != nil {
+					w.logf("for %q: %s\n", mv.Path, err)
+					continue
+				}
+				if dd != nil {
+					dds = append(dds, *dd)
+				}
+				continue
+			}
+			mv = r
+		}
+
+		repoRoot, err := vcs.RepoRootForImportPath(mv.Path, false)
+		if err != nil {
+			w.logf("for %q: %s\n", mv.Path, err)
+			continue
+		}
+		dds = append(dds, w.newDirDep(dir, repoRoot, moduleRev(mv, repoRoot.Root)))
+	}
+	return dds
+}
+
+// moduleRev converts a module version into a revision the module's
+// repository understands: the commit for pseudo-versions, and the tag
+// otherwise.
+func moduleRev(mv module.Version, repoRoot string) string {
+	if module.IsPseudoVersion(mv.Version) {
+		if rev, err := module.PseudoVersionRev(mv.Version); err == nil {
+			return rev
+		}
+	}
+	tag := strings.TrimSuffix(mv.Version, "+incompatible")
+	// Modules in a subdirectory of their repository are tagged with that
+	// subdirectory as a prefix.
+	prefix, _, _ := module.SplitPathVersion(mv.Path)
+	if sub := strings.TrimPrefix(prefix, repoRoot+"/"); sub != prefix {
+		tag = path.Join(sub, tag)
+	}
+	return tag
+}
+
+// localDirDep pins modPath to whatever is checked out in the repository that
+// contains localDir. It returns nil if localDir is part of the workspace's own
+// source: the workspace itself, or a project checked out in the workspace
+// outside the vendor gopath.
+func (w *workspace) localDirDep(srcDir, modPath, localDir string) (*dirDep, error) {
+	checkout := localDir
+	for vcsKindOf(checkout) == "" {
+		parent := filepath.Dir(checkout)
+		if parent == checkout {
+			return nil, fmt.Errorf("%q is not in a repository", localDir)
+		}
+		checkout = parent
+	}
+	vendorDir := filepath.Join(w.Root, w.VendorPath())
+	if checkout == w.Root || (withinDir(w.Root, checkout) && !withinDir(vendorDir, checkout)) {
+		return nil, nil
+	}
+
+	kind := vcsKindOf(checkout)
+	rev, err := vcsHead(kind, checkout)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := vcsOrigin(kind, checkout)
+	if err != nil {
+		return nil, err
+	}
+
+	// Work out which import path the checkout corresponds to by removing the
+	// subdirectory the module lives in.
+	rootPath, _, _ := module.SplitPathVersion(modPath)
+	sub, err := filepath.Rel(checkout, localDir)
+	if err != nil {
+		return nil, err
+	}
+	if sub != "." {
+		sub = filepath.ToSlash(sub)
+		if !strings.HasSuffix(rootPath, "/"+sub) {
+			return nil, fmt.Errorf("cannot find the repository root of %q in %q", modPath, checkout)
+		}
+		rootPath = strings.TrimSuffix(rootPath, "/"+sub)
+	}
+
+	return &dirDep{
+		srcDir: srcDir,
+		rev:    rev,
+		repo:   repo,
+		root:   filepath.Join(w.vendorRootSrc(), filepath.FromSlash(rootPath)),
+		kind:   kind,
+	}, nil
+}
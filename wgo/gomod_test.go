@@ -0,0 +1,76 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/skelterjohn/wgo/workspaces"
+	"golang.org/x/mod/modfile"
+)
+
+func TestGomodLocalReplace(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	tmp, err := ioutil.TempDir("", "wgo-gomod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// The workspace root is not a repository; each project in it is.
+	root := filepath.Join(tmp, "ws")
+	proj := filepath.Join(root, "src", "example.com", "proj")
+	sibling := filepath.Join(root, "src", "example.com", "sibling")
+	other := filepath.Join(tmp, "other")
+	for _, dir := range []string{proj, sibling, other} {
+		git(t, tmp, "init", "--quiet", dir)
+		git(t, dir, "commit", "--quiet", "--allow-empty", "-m", "first")
+	}
+	git(t, sibling, "remote", "add", "origin", "https://example.com/sibling.git")
+	git(t, other, "remote", "add", "origin", "https://example.com/other.git")
+
+	gomod := []byte(`module example.com/proj
+
+require (
+	example.com/sibling v0.0.0
+	example.com/other v0.0.0
+)
+
+replace example.com/sibling => ../sibling
+
+replace example.com/other => ` + other + `
+`)
+	mf, err := modfile.Parse("go.mod", gomod, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ws := wrap(&workspaces.Workspace{Root: root, Gopaths: []string{"vendor", "."}}, nil)
+	dds := ws.gomodDirDeps(proj, mf)
+	if len(dds) != 1 {
+		t.Fatalf("got %d dependencies, want only example.com/other: %+v", len(dds), dds)
+	}
+	if want := filepath.Join("vendor", "src", "example.com", "other"); dds[0].root != want {
+		t.Errorf("got %s, want %s", dds[0].root, want)
+	}
+	if dds[0].repo != "https://example.com/other.git" {
+		t.Errorf("got repository %s, want https://example.com/other.git", dds[0].repo)
+	}
+}
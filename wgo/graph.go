@@ -0,0 +1,262 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/skelterjohn/wgo/workspaces"
+)
+
+// Kinds of graph nodes.
+const (
+	NodeWorkspace = "workspace"
+	NodeExternal  = "external"
+)
+
+// GraphNode is a package, or a repository when collapsing by repository.
+type GraphNode struct {
+	ID   string
+	Kind string
+	// Pinned is set for external nodes whose repository is recorded in
+	// .gocfg/vendor.json.
+	Pinned bool
+	// Repo is the pinned repository directory the node belongs to.
+	Repo  string `json:",omitempty"`
+	Depth int
+}
+
+// GraphEdge is an import.
+type GraphEdge struct {
+	From string
+	To   string
+	// Test is set for imports made only by tests.
+	Test bool `json:",omitempty"`
+}
+
+// DepGraph is an import graph, as found by Graph.
+type DepGraph struct {
+	Nodes []*GraphNode
+	Edges []GraphEdge
+}
+
+// GraphOptions control Graph.
+type GraphOptions struct {
+	// ByRepo collapses the packages of each pinned repository into one
+	// node, named by the repository's import path.
+	ByRepo bool
+	// Kind, if set, keeps only NodeWorkspace or NodeExternal nodes.
+	Kind string
+	// Tests adds the imports of the workspace packages' tests.
+	Tests bool
+	// MaxDepth, if positive, leaves out packages more than MaxDepth imports
+	// away from the workspace's own packages. Zero means no limit.
+	MaxDepth int
+}
+
+// Graph returns the import graph of the workspace's own packages, leaving out
+// the standard library.
+func Graph(w *workspaces.Workspace, opts GraphOptions) (*DepGraph, error) {
+	ws := wrap(w, nil)
+	cfg, err := ws.loadVendorConfig()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	ig, err := ws.loadImportGraph([]string{"./src/..."})
+	if err != nil {
+		return nil, err
+	}
+
+	dg := ws.buildDepGraph(ig, cfg, opts.Tests, opts.MaxDepth, opts.ByRepo)
+	dg.filter(opts.Kind)
+	return dg, nil
+}
+
+// buildDepGraph turns an import graph into nodes and edges, leaving out the
+// standard library and, if maxDepth is positive, anything deeper than maxDepth
+// imports from the roots.
+func (w *workspace) buildDepGraph(ig *importGraph, cfg vendorConfig, withTests bool, maxDepth int, byRepo bool) *DepGraph {
+	srcDir := filepath.Join(w.Root, "src")
+
+	// Find each package's depth with a breadth first walk from the roots.
+	depth := map[string]int{}
+	var queue []string
+	for _, root := range ig.roots {
+		depth[root] = 0
+		queue = append(queue, root)
+	}
+	type pkgEdge struct {
+		from, to string
+		test     bool
+	}
+	var edges []pkgEdge
+	for len(queue) != 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+		p, ok := ig.pkgs[pkg]
+		if !ok || (maxDepth > 0 && depth[pkg] >= maxDepth) {
+			continue
+		}
+		follow := func(imp string, test bool) {
+			if q, ok := ig.pkgs[imp]; !ok || q.Standard || imp == pkg {
+				return
+			}
+			edges = append(edges, pkgEdge{pkg, imp, test})
+			if _, ok := depth[imp]; !ok {
+				depth[imp] = depth[pkg] + 1
+				queue = append(queue, imp)
+			}
+		}
+		for _, imp := range p.Imports {
+			follow(imp, false)
+		}
+		if withTests && ig.isRoot(pkg) {
+			for _, imp := range p.testImports() {
+				follow(imp, true)
+			}
+		}
+	}
+
+	pinDirs := cfg.dirs()
+	nodeOf := map[string]*GraphNode{}
+	nodes := map[string]*GraphNode{}
+	for pkg, d := range depth {
+		p := ig.pkgs[pkg]
+		n := &GraphNode{ID: pkg, Kind: NodeExternal, Depth: d}
+		if p != nil && withinDir(srcDir, p.Dir) {
+			n.Kind = NodeWorkspace
+		}
+		if p != nil {
+			for _, dir := range pinDirs {
+				if withinDir(filepath.Join(w.Root, dir), p.Dir) {
+					n.Pinned = true
+					n.Repo = dir
+					break
+				}
+			}
+		}
+		if byRepo && n.Repo != "" {
+			n.ID = w.repoImportPath(n.Repo)
+		}
+		if existing, ok := nodes[n.ID]; ok {
+			if n.Depth < existing.Depth {
+				existing.Depth = n.Depth
+			}
+			n = existing
+		} else {
+			nodes[n.ID] = n
+		}
+		nodeOf[pkg] = n
+	}
+
+	dg := &DepGraph{}
+	for _, n := range nodes {
+		dg.Nodes = append(dg.Nodes, n)
+	}
+	sort.Slice(dg.Nodes, func(i, j int) bool { return dg.Nodes[i].ID < dg.Nodes[j].ID })
+
+	// Add normal imports before test imports, so that a test import of
+	// something that is also imported normally is left out.
+	seen := map[[2]string]bool{}
+	for _, test := range []bool{false, true} {
+		for _, e := range edges {
+			from, to := nodeOf[e.from], nodeOf[e.to]
+			if e.test != test || from == nil || to == nil || from == to {
+				continue
+			}
+			key := [2]string{from.ID, to.ID}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			dg.Edges = append(dg.Edges, GraphEdge{From: from.ID, To: to.ID, Test: test})
+		}
+	}
+	sort.Slice(dg.Edges, func(i, j int) bool {
+		if dg.Edges[i].From != dg.Edges[j].From {
+			return dg.Edges[i].From < dg.Edges[j].From
+		}
+		return dg.Edges[i].To < dg.Edges[j].To
+	})
+	return dg
+}
+
+// repoImportPath returns the import path of a pinned repository directory.
+func (w *workspace) repoImportPath(dir string) string {
+	for _, gopath := range w.Gopaths {
+		src := filepath.Join(gopath, "src")
+		if rel, err := filepath.Rel(src, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(dir)
+}
+
+// filter keeps only nodes of the given kind, and the edges between them.
+func (dg *DepGraph) filter(kind string) {
+	if kind == "" {
+		return
+	}
+	keep := map[string]bool{}
+	var nodes []*GraphNode
+	for _, n := range dg.Nodes {
+		if n.Kind == kind {
+			keep[n.ID] = true
+			nodes = append(nodes, n)
+		}
+	}
+	var edges []GraphEdge
+	for _, e := range dg.Edges {
+		if keep[e.From] && keep[e.To] {
+			edges = append(edges, e)
+		}
+	}
+	dg.Nodes, dg.Edges = nodes, edges
+}
+
+// WriteDOT writes the graph for Graphviz. Workspace packages are boxes,
+// pinned dependencies are green and unpinned ones red; test imports are
+// dashed.
+func (dg *DepGraph) WriteDOT(out io.Writer) error {
+	bw := bufio.NewWriter(out)
+	fmt.Fprintln(bw, "digraph wgo {")
+	fmt.Fprintln(bw, "\tnode [style=filled, fillcolor=white];")
+	for _, n := range dg.Nodes {
+		var attrs []string
+		switch {
+		case n.Kind == NodeWorkspace:
+			attrs = append(attrs, "shape=box")
+		case n.Pinned:
+			attrs = append(attrs, "fillcolor=palegreen")
+		default:
+			attrs = append(attrs, "fillcolor=salmon")
+		}
+		fmt.Fprintf(bw, "\t%q [%s];\n", n.ID, strings.Join(attrs, ", "))
+	}
+	for _, e := range dg.Edges {
+		if e.Test {
+			fmt.Fprintf(bw, "\t%q -> %q [style=dashed];\n", e.From, e.To)
+		} else {
+			fmt.Fprintf(bw, "\t%q -> %q;\n", e.From, e.To)
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// listedPackage holds the fields of 'go list -json' output that wgo uses.
+type listedPackage struct {
+	ImportPath   string
+	Dir          string
+	Standard     bool
+	Imports      []string
+	TestImports  []string
+	XTestImports []string
+}
+
+// importGraph is the package import graph reachable from a set of root
+// packages, including the imports of the roots' tests.
+type importGraph struct {
+	roots []string
+	pkgs  map[string]*listedPackage
+}
+
+// loadImportGraph lists targets and everything they, or their tests, import.
+// It uses the same two go list passes as listDeps, but keeps the edges.
+func (w *workspace) loadImportGraph(targets []string) (*importGraph, error) {
+	g := &importGraph{pkgs: map[string]*listedPackage{}}
+
+	roots, err := w.goListJSON(append([]string{"list", "-e", "-json"}, targets...))
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var all []string
+	for _, p := range roots {
+		g.roots = append(g.roots, p.ImportPath)
+		all = append(all, p.ImportPath)
+		seen[p.ImportPath] = true
+	}
+	for _, p := range roots {
+		for _, imp := range p.testImports() {
+			if !seen[imp] {
+				seen[imp] = true
+				all = append(all, imp)
+			}
+		}
+	}
+	sort.Strings(g.roots)
+
+	deps, err := w.goListJSON(append([]string{"list", "-e", "-json", "-deps"}, all...))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range deps {
+		g.pkgs[p.ImportPath] = p
+	}
+	// The roots' test imports only show up in the first pass.
+	for _, p := range roots {
+		if q, ok := g.pkgs[p.ImportPath]; ok {
+			q.TestImports, q.XTestImports = p.TestImports, p.XTestImports
+		} else {
+			g.pkgs[p.ImportPath] = p
+		}
+	}
+	return g, nil
+}
+
+func (w *workspace) goListJSON(args []string) ([]*listedPackage, error) {
+	var buf bytes.Buffer
+	cmd, err := w.goCmd(args...)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = &buf
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	var pkgs []*listedPackage
+	dec := json.NewDecoder(&buf)
+	for {
+		p := &listedPackage{}
+		if err := dec.Decode(p); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, nil
+}
+
+// testImports returns the packages imported only by p's tests.
+func (p *listedPackage) testImports() []string {
+	return append(append([]string(nil), p.TestImports...), p.XTestImports...)
+}
+
+// isRoot reports whether pkg is one of the graph's roots.
+func (g *importGraph) isRoot(pkg string) bool {
+	i := sort.SearchStrings(g.roots, pkg)
+	return i < len(g.roots) && g.roots[i] == pkg
+}
+
+// shortestChain finds the shortest import chain from root to target,
+// following only non-test imports. It returns nil if there isn't one.
+func (g *importGraph) shortestChain(root, target string) []string {
+	parent := map[string]string{root: ""}
+	queue := []string{root}
+	for len(queue) != 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+		if pkg == target {
+			var chain []string
+			for ; pkg != ""; pkg = parent[pkg] {
+				chain = append([]string{pkg}, chain...)
+			}
+			return chain
+		}
+		p, ok := g.pkgs[pkg]
+		if !ok {
+			continue
+		}
+		for _, imp := range p.Imports {
+			if _, ok := parent[imp]; !ok {
+				parent[imp] = pkg
+				queue = append(queue, imp)
+			}
+		}
+	}
+	return nil
+}
+
+// shortestTestChain finds the shortest chain from root to target that starts
+// with one of the imports of root's tests.
+func (g *importGraph) shortestTestChain(root, target string) []string {
+	p, ok := g.pkgs[root]
+	if !ok {
+		return nil
+	}
+	var best []string
+	for _, imp := range p.testImports() {
+		if imp == root {
+			// An external test package importing the package under test.
+			continue
+		}
+		if chain := g.shortestChain(imp, target); chain != nil && (best == nil || len(chain)+1 < len(best)) {
+			best = append([]string{root}, chain...)
+		}
+	}
+	return best
+}
@@ -0,0 +1,311 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/skelterjohn/wgo/workspaces"
+)
+
+const licenseUnknown = "unknown"
+
+// RepoLicense is the license report for one repository in the dependency
+// closure.
+type RepoLicense struct {
+	ImportPath string
+	Dir        string
+	URL        string `json:",omitempty"`
+	Rev        string `json:",omitempty"`
+	Licenses   []string
+	// Files are the license and notice files found, relative to the
+	// workspace root when they are inside it.
+	Files []string
+
+	absDir  string
+	pkgDirs []string
+	paths   []string
+}
+
+// LicensesOptions control Licenses.
+type LicensesOptions struct {
+	// Tests includes what the workspace packages' tests import.
+	Tests bool
+	// Deny lists license identifiers, like "AGPL" or "GPL-3.0", that no
+	// dependency may use. A family like "GPL" also denies its versions.
+	Deny []string
+}
+
+// Licenses reports the license of every repository the workspace depends on.
+// If a repository uses a denied license, the report is still returned, along
+// with an Errors holding an ItemError for each denial.
+func Licenses(w *workspaces.Workspace, opts LicensesOptions) ([]*RepoLicense, error) {
+	ws := wrap(w, nil)
+	cfg, err := ws.loadVendorConfig()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	repos, err := ws.dependencyRepos(cfg, opts.Tests)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range repos {
+		if err := r.scan(ws); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	for _, r := range repos {
+		for _, l := range r.Licenses {
+			if licenseDenied(l, opts.Deny) {
+				errs = append(errs, &ItemError{Item: r.ImportPath, Err: fmt.Errorf("%s is denied", l)})
+			}
+		}
+	}
+	return repos, errorsOrNil(errs)
+}
+
+// dependencyRepos groups the external packages imported from the workspace
+// by repository. A package is external if it is pinned in vendor.json or lives
+// outside "W/src".
+func (w *workspace) dependencyRepos(cfg vendorConfig, withTests bool) ([]*RepoLicense, error) {
+	ig, err := w.loadImportGraph([]string{"./src/..."})
+	if err != nil {
+		return nil, err
+	}
+	dg := w.buildDepGraph(ig, cfg, withTests, -1, false)
+
+	byDir := map[string]*RepoLicense{}
+	for _, n := range dg.Nodes {
+		p := ig.pkgs[n.ID]
+		if p == nil || p.Dir == "" || (n.Kind == NodeWorkspace && !n.Pinned) {
+			continue
+		}
+		r := &RepoLicense{}
+		if n.Pinned {
+			pin := cfg[n.Repo]
+			r.absDir = filepath.Join(w.Root, n.Repo)
+			r.ImportPath = w.repoImportPath(n.Repo)
+			r.URL, r.Rev = pin.URL, pin.Rev
+		} else {
+			r.absDir, r.ImportPath = unpinnedRepoRoot(p)
+		}
+		if existing, ok := byDir[r.absDir]; ok {
+			r = existing
+		} else {
+			byDir[r.absDir] = r
+		}
+		// Packages may carry their own license files, besides the
+		// repository's.
+		r.pkgDirs = append(r.pkgDirs, p.Dir)
+	}
+
+	var repos []*RepoLicense
+	for _, r := range byDir {
+		r.Dir = r.absDir
+		if rel, err := filepath.Rel(w.Root, r.absDir); err == nil && !strings.HasPrefix(rel, "..") {
+			r.Dir = rel
+		}
+		repos = append(repos, r)
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].ImportPath < repos[j].ImportPath })
+	return repos, nil
+}
+
+// unpinnedRepoRoot guesses the repository containing p: the nearest directory
+// with a checkout, or else the outermost one with a license file, without
+// leaving p's gopath.
+func unpinnedRepoRoot(p *listedPackage) (dir, importPath string) {
+	suffix := filepath.FromSlash(p.ImportPath)
+	if !strings.HasSuffix(p.Dir, suffix) {
+		return p.Dir, p.ImportPath
+	}
+	src := strings.TrimSuffix(p.Dir, suffix)
+
+	dir, importPath = p.Dir, p.ImportPath
+	for d := p.Dir; len(d) > len(src); d = filepath.Dir(d) {
+		if vcsKindOf(d) != "" {
+			dir = d
+			break
+		}
+		if len(findLicenseFiles(d)) != 0 {
+			dir = d
+		}
+	}
+	return dir, filepath.ToSlash(dir[len(src):])
+}
+
+// scan finds the license files in r's root and package directories, and
+// classifies them.
+func (r *RepoLicense) scan(w *workspace) error {
+	dirs := append([]string{r.absDir}, r.pkgDirs...)
+	seen := map[string]bool{}
+	ids := map[string]bool{}
+	for _, dir := range dirs {
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		for _, path := range findLicenseFiles(dir) {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			r.paths = append(r.paths, path)
+			if rel, err := filepath.Rel(w.Root, path); err == nil && !strings.HasPrefix(rel, "..") {
+				r.Files = append(r.Files, rel)
+			} else {
+				r.Files = append(r.Files, path)
+			}
+			if isNoticeFile(path) {
+				continue
+			}
+			ids[classifyLicense(data)] = true
+		}
+	}
+	// A recognized license makes an unrecognized extra file uninteresting.
+	if len(ids) > 1 {
+		delete(ids, licenseUnknown)
+	}
+	for id := range ids {
+		r.Licenses = append(r.Licenses, id)
+	}
+	if len(r.Licenses) == 0 {
+		r.Licenses = []string{licenseUnknown}
+	}
+	sort.Strings(r.Licenses)
+	return nil
+}
+
+// findLicenseFiles lists the LICENSE, COPYING and NOTICE files in dir.
+func findLicenseFiles(dir string) []string {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, fi := range fis {
+		if fi.IsDir() {
+			continue
+		}
+		if isLicenseFileName(fi.Name()) {
+			paths = append(paths, filepath.Join(dir, fi.Name()))
+		}
+	}
+	return paths
+}
+
+// isLicenseFileName reports whether a file is a LICENSE, COPYING or NOTICE
+// file, by its name.
+func isLicenseFileName(name string) bool {
+	name = strings.ToUpper(name)
+	for _, prefix := range []string{"LICENSE", "LICENCE", "COPYING", "NOTICE"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isNoticeFile(path string) bool {
+	return strings.HasPrefix(strings.ToUpper(filepath.Base(path)), "NOTICE")
+}
+
+// classifyLicense recognizes a license from phrases in its text, returning an
+// SPDX identifier or "unknown".
+func classifyLicense(data []byte) string {
+	text := strings.Join(strings.Fields(strings.ToLower(string(data))), " ")
+	has := func(phrases ...string) bool {
+		for _, p := range phrases {
+			if !strings.Contains(text, p) {
+				return false
+			}
+		}
+		return true
+	}
+	gnuVersion := func(id string) string {
+		switch {
+		case has("version 3"):
+			return id + "-3.0"
+		case has("version 2.1"):
+			return id + "-2.1"
+		case has("version 2"):
+			return id + "-2.0"
+		}
+		return id
+	}
+	switch {
+	case has("gnu affero general public license"):
+		return gnuVersion("AGPL")
+	case has("gnu lesser general public license"), has("gnu library general public license"):
+		return gnuVersion("LGPL")
+	case has("gnu general public license"):
+		return gnuVersion("GPL")
+	case has("mozilla public license"):
+		if has("version 2.0") || has("mozilla public license, v. 2.0") {
+			return "MPL-2.0"
+		}
+		return "MPL"
+	case has("apache license", "version 2.0"):
+		return "Apache-2.0"
+	case has("redistribution and use in source and binary forms"):
+		if has("neither the name") || has("may be used to endorse or promote products") {
+			return "BSD-3-Clause"
+		}
+		return "BSD-2-Clause"
+	case has("permission is hereby granted, free of charge, to any person obtaining a copy"):
+		return "MIT"
+	}
+	return licenseUnknown
+}
+
+// licenseDenied reports whether id is in denied. A denied family like "GPL"
+// also matches its versions, like "GPL-2.0".
+func licenseDenied(id string, denied []string) bool {
+	for _, d := range denied {
+		if strings.EqualFold(id, d) || strings.HasPrefix(strings.ToLower(id), strings.ToLower(d)+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteNotice concatenates every repository's license and notice files into
+// one file, at path, to ship alongside a binary.
+func WriteNotice(path string, repos []*RepoLicense) error {
+	var buf bytes.Buffer
+	for _, r := range repos {
+		if len(r.paths) == 0 {
+			continue
+		}
+		rule := strings.Repeat("=", 79)
+		fmt.Fprintf(&buf, "%s\n%s (%s)\n%s\n", rule, r.ImportPath, strings.Join(r.Licenses, ", "), rule)
+		for _, p := range r.paths {
+			data, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&buf, "\n%s\n", bytes.TrimSpace(data))
+		}
+		buf.WriteString("\n")
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// lockFormat describes a lock file written by another dependency manager.
+type lockFormat struct {
+	fileName string
+	parse    func(io.Reader) ([]Dependency, error)
+}
+
+// lockFormats maps the names accepted in SaveOptions.LockFormats to the
+// formats they read.
+var lockFormats = map[string]lockFormat{
+	"glide": {"glide.lock", parseGlideLock},
+	"dep":   {"Gopkg.lock", parseDepLock},
+	"vndr":  {"vendor.conf", parseVndrConf},
+}
+
+// importLockFiles collects revision pins from every lock file of the given
+// format in the workspace.
+func (w *workspace) importLockFiles(format string) ([]dirDep, error) {
+	lf, ok := lockFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown lock file format %q", format)
+	}
+
+	var dds []dirDep
+	scanDir := func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() != lf.fileName {
+			return nil
+		}
+		fin, err := os.Open(path)
+		if err != nil {
+			w.logf("%s\n", err)
+			return nil
+		}
+		defer fin.Close()
+		deps, err := lf.parse(fin)
+		if err != nil {
+			w.logf("%s: %s\n", path, err)
+			return nil
+		}
+		dir := filepath.Dir(path)
+		for _, dep := range deps {
+			dd, err := w.resolveDependency(dir, dep)
+			if err != nil {
+				w.logf("for %q: %s\n", dep.ImportPath, err)
+				continue
+			}
+			dds = append(dds, dd)
+		}
+		return nil
+	}
+	filepath.Walk(w.Root, scanDir)
+	return dds, nil
+}
+
+// parseGlideLock reads the imports and testImports of a glide.lock file.
+func parseGlideLock(r io.Reader) ([]Dependency, error) {
+	var deps []Dependency
+	inList := false
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "-") {
+			// A new top-level key.
+			inList = trimmed == "imports:" || trimmed == "testImports:"
+			continue
+		}
+		if !inList {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "- ") && strings.HasPrefix(line, "-") {
+			// glide writes list items without indentation, so only those
+			// start a new dependency; indented items are subpackages.
+			deps = append(deps, Dependency{})
+			trimmed = strings.TrimSpace(trimmed[2:])
+		}
+		if len(deps) == 0 {
+			continue
+		}
+		key, value, ok := splitYAMLField(trimmed)
+		if !ok {
+			continue
+		}
+		dep := &deps[len(deps)-1]
+		switch key {
+		case "name":
+			dep.ImportPath = value
+		case "version":
+			dep.Rev = value
+		case "repo":
+			dep.Repo = value
+		case "vcs":
+			dep.VCS = value
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return checkDependencies(deps)
+}
+
+func splitYAMLField(s string) (key, value string, ok bool) {
+	i := strings.Index(s, ":")
+	if i < 0 {
+		return "", "", false
+	}
+	key = strings.TrimSpace(s[:i])
+	value = strings.TrimSpace(s[i+1:])
+	if uq, err := strconv.Unquote(value); err == nil {
+		value = uq
+	} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		value = value[1 : len(value)-1]
+	}
+	return key, value, true
+}
+
+// parseDepLock reads the [[projects]] of a dep Gopkg.lock file.
+func parseDepLock(r io.Reader) ([]Dependency, error) {
+	var deps []Dependency
+	inProject := false
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			inProject = line == "[[projects]]"
+			if inProject {
+				deps = append(deps, Dependency{})
+			}
+			continue
+		}
+		if !inProject {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			// The continuation of a multi-line array.
+			continue
+		}
+		key := strings.TrimSpace(line[:i])
+		value, err := strconv.Unquote(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			// Arrays and other values we don't need.
+			continue
+		}
+		dep := &deps[len(deps)-1]
+		switch key {
+		case "name":
+			dep.ImportPath = value
+		case "revision":
+			dep.Rev = value
+		case "source":
+			dep.Repo = value
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return checkDependencies(deps)
+}
+
+// parseVndrConf reads a vendor.conf file as used by vndr and trash, with one
+// "IMPORTPATH REVISION [REPOURL]" entry per line.
+func parseVndrConf(r io.Reader) ([]Dependency, error) {
+	var deps []Dependency
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			// trash names the package being vendored for on its own line.
+			continue
+		case 2:
+			deps = append(deps, Dependency{ImportPath: fields[0], Rev: fields[1]})
+		default:
+			deps = append(deps, Dependency{ImportPath: fields[0], Rev: fields[1], Repo: fields[2]})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return checkDependencies(deps)
+}
+
+func checkDependencies(deps []Dependency) ([]Dependency, error) {
+	for _, dep := range deps {
+		if dep.ImportPath == "" {
+			return nil, fmt.Errorf("dependency without a name")
+		}
+		if dep.Rev == "" {
+			return nil, fmt.Errorf("no revision for %q", dep.ImportPath)
+		}
+	}
+	return deps, nil
+}
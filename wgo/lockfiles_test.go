@@ -0,0 +1,106 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parseFixture(t *testing.T, name string, parse func(io.Reader) ([]Dependency, error)) []Dependency {
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	deps, err := parse(f)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", name, err)
+	}
+	return deps
+}
+
+func TestParseGlideLock(t *testing.T) {
+	deps := parseFixture(t, "glide.lock", parseGlideLock)
+	want := []Dependency{
+		// The indented subpackage list, even one with a "name", belongs
+		// to the dependency above it.
+		{ImportPath: "github.com/gorilla/mux", Rev: "9c068cf16d982f8bd444b8c352acbeec34c4fe5b"},
+		{
+			ImportPath: "golang.org/x/net",
+			Rev:        "0c607074acd38c5f23d1344dfe74c977464d1257",
+			Repo:       "https://go.googlesource.com/net",
+			VCS:        "git",
+		},
+		// testImports are pinned too.
+		{ImportPath: "github.com/stretchr/testify", Rev: "f390dcf405f7b83c997eac1b06768bb9f44dec18"},
+	}
+	if !reflect.DeepEqual(deps, want) {
+		t.Errorf("got %+v\nwant %+v", deps, want)
+	}
+}
+
+func TestParseDepLock(t *testing.T) {
+	deps := parseFixture(t, "Gopkg.lock", parseDepLock)
+	want := []Dependency{
+		// The multi-line packages array doesn't end the project.
+		{ImportPath: "github.com/golang/protobuf", Rev: "1e59b77b52bf8e4b449a57e6f79f21226d571845"},
+		// source says where the repository lives.
+		{
+			ImportPath: "github.com/pkg/errors",
+			Rev:        "645ef00459ed84a119197bfb8d8205042c6df63d",
+			Repo:       "https://github.com/forks/errors.git",
+		},
+	}
+	if !reflect.DeepEqual(deps, want) {
+		t.Errorf("got %+v\nwant %+v", deps, want)
+	}
+}
+
+func TestParseVndrConf(t *testing.T) {
+	deps := parseFixture(t, "vendor.conf", parseVndrConf)
+	want := []Dependency{
+		// The one field line, naming the project, is skipped.
+		{ImportPath: "github.com/Sirupsen/logrus", Rev: "v0.11.0"},
+		{ImportPath: "github.com/docker/go-units", Rev: "0bbddae09c5a5419a8c6dcdd7ff90da3d450393b"},
+		{
+			ImportPath: "golang.org/x/sys",
+			Rev:        "8f0908ab3b2457e2e15403d3697c9ef5cb4b57a9",
+			Repo:       "https://github.com/golang/sys.git",
+		},
+	}
+	if !reflect.DeepEqual(deps, want) {
+		t.Errorf("got %+v\nwant %+v", deps, want)
+	}
+}
+
+func TestLockWithoutRevision(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		parse func(io.Reader) ([]Dependency, error)
+		data  string
+	}{
+		{"glide", parseGlideLock, "imports:\n- name: github.com/a/b\n"},
+		{"dep", parseDepLock, "[[projects]]\n  name = \"github.com/a/b\"\n  version = \"v1.0.0\"\n"},
+	} {
+		_, err := tc.parse(strings.NewReader(tc.data))
+		if err == nil || !strings.Contains(err.Error(), `no revision for "github.com/a/b"`) {
+			t.Errorf("%s: got error %v, want a missing revision", tc.name, err)
+		}
+	}
+}
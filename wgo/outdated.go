@@ -0,0 +1,153 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/skelterjohn/wgo/workspaces"
+	"golang.org/x/mod/semver"
+)
+
+// PinAge describes how far a pin lags behind its upstream repository.
+type PinAge struct {
+	Dir        string
+	URL        string
+	Pinned     string
+	PinnedDate *time.Time `json:",omitempty"`
+	Tip        string     `json:",omitempty"`
+	// Behind is the number of commits between the pin and the tip, or -1 if
+	// that is unknown because the pin's history isn't available locally.
+	Behind    int
+	LatestTag string `json:",omitempty"`
+	Error     string `json:",omitempty"`
+}
+
+// Outdated reports, for every pin, the upstream default branch tip and newest
+// release tag. Repositories that can't be reached have Error set.
+func Outdated(w *workspaces.Workspace) ([]PinAge, error) {
+	ws := wrap(w, nil)
+	cfg, err := ws.loadVendorConfig()
+	if err != nil {
+		return nil, err
+	}
+	c := newRepoCache(CacheDir())
+
+	var ages []PinAge
+	for _, dir := range cfg.dirs() {
+		ages = append(ages, ws.pinAge(c, dir, cfg[dir]))
+	}
+	return ages, nil
+}
+
+func (w *workspace) pinAge(c *repoCache, dir string, pin Pin) PinAge {
+	a := PinAge{
+		Dir:    dir,
+		URL:    pin.URL,
+		Pinned: pin.Rev,
+		Behind: -1,
+	}
+	var err error
+	if a.Tip, err = remoteTip(pin.Type, pin.URL); err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	if tags, err := remoteTags(pin.Type, pin.URL); err == nil {
+		a.LatestTag = newestVersionTag(tags)
+	}
+
+	// The history needed for the date and distance may be in the checkout or
+	// in the shared cache. If the tip is newer than either, it is fetched
+	// without moving any refs.
+	for _, local := range []string{filepath.Join(w.Root, dir), c.mirrorPath(pin)} {
+		if _, err := os.Stat(local); err != nil || !vcsHasRev(pin.Type, local, pin.Rev) {
+			continue
+		}
+		if a.PinnedDate == nil {
+			if t, err := vcsRevTime(pin.Type, local, pin.Rev); err == nil {
+				t = t.Local()
+				a.PinnedDate = &t
+			}
+		}
+		if a.Behind < 0 && !vcsHasRev(pin.Type, local, a.Tip) {
+			vcsFetchRev(pin.Type, local, pin.URL, a.Tip)
+		}
+		if a.Behind < 0 && vcsHasRev(pin.Type, local, a.Tip) {
+			if changes, err := vcsLog(pin.Type, local, pin.Rev, a.Tip); err == nil {
+				a.Behind = len(changes)
+			}
+		}
+	}
+	return a
+}
+
+// remoteTip asks the repository at url for the newest revision on its
+// default branch.
+func remoteTip(kind, url string) (string, error) {
+	switch kind {
+	case "git":
+		out, err := vcsOutput("", "git", "ls-remote", url, "HEAD")
+		if err != nil {
+			return "", err
+		}
+		fields := strings.Fields(out)
+		if len(fields) == 0 {
+			return "", fmt.Errorf("%s has no HEAD", url)
+		}
+		return fields[0], nil
+	case "hg":
+		return vcsOutput("", "hg", "identify", "--debug", "-r", "default", "--id", url)
+	}
+	return "", fmt.Errorf("unsupported VCS %q", kind)
+}
+
+// remoteTags lists the tags of the repository at url. Mercurial cannot list
+// remote tags without pulling, so only git is supported.
+func remoteTags(kind, url string) ([]string, error) {
+	if kind != "git" {
+		return nil, fmt.Errorf("cannot list remote tags for %s", kind)
+	}
+	out, err := vcsOutput("", "git", "ls-remote", "--tags", url)
+	if err != nil || out == "" {
+		return nil, err
+	}
+	var tags []string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.HasSuffix(fields[1], "^{}") {
+			continue
+		}
+		tags = append(tags, strings.TrimPrefix(fields[1], "refs/tags/"))
+	}
+	return tags, nil
+}
+
+// newestVersionTag returns the tag with the highest release version.
+func newestVersionTag(tags []string) string {
+	best, bestVersion := "", ""
+	for _, tag := range tags {
+		v := canonicalVersion(tag)
+		if v == "" || semver.Prerelease(v) != "" {
+			continue
+		}
+		if best == "" || semver.Compare(v, bestVersion) > 0 {
+			best, bestVersion = tag, v
+		}
+	}
+	return best
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/skelterjohn/wgo/workspaces"
+)
+
+func git(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=wgo", "GIT_AUTHOR_EMAIL=wgo@example.com",
+		"GIT_COMMITTER_NAME=wgo", "GIT_COMMITTER_EMAIL=wgo@example.com",
+		"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return string(out)
+}
+
+func TestPinAge(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	tmp, err := ioutil.TempDir("", "wgo-outdated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	upstream := filepath.Join(tmp, "a.git")
+	work := filepath.Join(tmp, "work")
+	git(t, tmp, "init", "--quiet", "--bare", upstream)
+	git(t, tmp, "init", "--quiet", work)
+	commit := func(msg string) string {
+		git(t, work, "commit", "--quiet", "--allow-empty", "-m", msg)
+		rev, err := vcsHead("git", work)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rev
+	}
+	push := func() {
+		git(t, work, "push", "--quiet", "--tags", upstream, "HEAD:refs/heads/master")
+	}
+
+	pinned := commit("first")
+	git(t, work, "tag", "v1.0.0")
+	push()
+
+	// The checkout only knows the history up to the pin.
+	root := filepath.Join(tmp, "ws")
+	dir := filepath.Join("vendor", "src", "example.com", "a")
+	git(t, tmp, "clone", "--quiet", upstream, filepath.Join(root, dir))
+
+	commit("second")
+	git(t, work, "tag", "v1.2.0")
+	commit("third")
+	git(t, work, "tag", "v2.0.0-rc.1")
+	tip := commit("fourth")
+	push()
+
+	ws := wrap(&workspaces.Workspace{Root: root}, nil)
+	c := newRepoCache(filepath.Join(tmp, "cache"))
+	pin := Pin{Type: "git", URL: upstream, Rev: pinned}
+	a := ws.pinAge(c, dir, pin)
+	if a.Error != "" {
+		t.Fatal(a.Error)
+	}
+	if a.Tip != tip {
+		t.Errorf("got tip %s, want %s", a.Tip, tip)
+	}
+	if a.Behind != 3 {
+		t.Errorf("got %d commits behind, want 3", a.Behind)
+	}
+	if a.LatestTag != "v1.2.0" {
+		t.Errorf("got latest tag %q, want v1.2.0", a.LatestTag)
+	}
+	if a.PinnedDate == nil {
+		t.Error("no date for the pinned revision")
+	}
+}
@@ -0,0 +1,396 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/skelterjohn/vfu/vend"
+	"github.com/skelterjohn/wgo/workspaces"
+)
+
+// OutsidePackagesOptions control OutsidePackages.
+type OutsidePackagesOptions struct {
+	// Targets are extra packages or patterns to look at, besides everything
+	// in the workspace's gopaths.
+	Targets []string
+	// Platforms to collect dependencies for. If empty, the workspace's
+	// configured platforms are used, or else the host.
+	Platforms []Platform
+}
+
+// OutsidePackages maps the import path of every package that the workspace
+// depends on, but that lives outside of it, to its directory.
+func OutsidePackages(w *workspaces.Workspace, opts OutsidePackagesOptions) (map[string]string, error) {
+	ws := wrap(w, nil)
+	plats, err := ws.platforms(opts.Platforms)
+	if err != nil {
+		return nil, err
+	}
+	return ws.outsidePackages(opts.Targets, plats)
+}
+
+func (w *workspace) outsidePackages(targets []string, plats []Platform) (map[string]string, error) {
+	targets = append([]string(nil), targets...)
+	for _, gopath := range w.Gopaths {
+		target := "./" + gopath + "/src/..." // filepath.Join() doesn't like a leading dot.
+		targets = append(targets, target)
+	}
+	pkgs, err := w.listDeps(targets, plats)
+	if err != nil {
+		return nil, err
+	}
+	for pkg, dir := range pkgs {
+		if !filepath.IsAbs(dir) {
+			delete(pkgs, pkg)
+			continue
+		}
+		if x, err := filepath.Rel(w.Root, dir); err == nil && !strings.HasPrefix(x, "..") {
+			delete(pkgs, pkg)
+		}
+	}
+	return pkgs, nil
+}
+
+// listDeps finds the directories of all non-standard packages that targets,
+// or their tests, depend on, on any of plats.
+func (w *workspace) listDeps(targets []string, plats []Platform) (map[string]string, error) {
+	seen := map[string]bool{}
+	var all []string
+	for _, p := range plats {
+		deps, err := w.listPlatformDeps(targets, p)
+		if err != nil {
+			return nil, err
+		}
+		for _, pkg := range deps {
+			if !seen[pkg] {
+				seen[pkg] = true
+				all = append(all, pkg)
+			}
+		}
+	}
+
+	goroot := runtime.GOROOT()
+	bctx := build.Default
+	bctx.GOPATH = w.Gopath(true)
+
+	pkgs := map[string]string{}
+	for _, pkg := range all {
+		p, err := bctx.Import(pkg, w.Root, build.FindOnly)
+		if err != nil {
+			continue
+		}
+		if x, err := filepath.Rel(goroot, p.Dir); err == nil && !strings.HasPrefix(x, "..") {
+			continue
+		}
+		pkgs[pkg] = p.Dir
+	}
+	return pkgs, nil
+}
+
+// listPlatformDeps lists targets and everything they, or their tests, import
+// on platform p.
+func (w *workspace) listPlatformDeps(targets []string, p Platform) ([]string, error) {
+	targets = append([]string(nil), targets...)
+	goListTestArgs := []string{"list", "-e", "-f", "{{range .TestImports}}{{.}}\n{{end}}"}
+	goListTestArgs = append(goListTestArgs, targets...)
+	var testBuf bytes.Buffer
+	cmd, err := w.goListCmd(p, goListTestArgs...)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = &testBuf
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	for _, pkg := range strings.Split(testBuf.String(), "\n") {
+		if pkg == "" {
+			continue
+		}
+		targets = append(targets, pkg)
+	}
+
+	goListArgs := []string{"list", "-e", "-f", "{{.ImportPath}}\n{{range .Deps}}{{.}}\n{{end}}"}
+	goListArgs = append(goListArgs, targets...)
+	var buf bytes.Buffer
+	cmd, err = w.goListCmd(p, goListArgs...)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = &buf
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	var pkgs []string
+	for _, pkg := range strings.Split(buf.String(), "\n") {
+		if pkg != "" {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	return pkgs, nil
+}
+
+// SaveOptions control Save.
+type SaveOptions struct {
+	// Targets are extra packages or patterns whose dependencies are saved.
+	Targets []string
+	// Platforms to collect dependencies for. If empty, the workspace's
+	// configured platforms are used, or else the host.
+	Platforms []Platform
+	// Godeps and Gomod import pins from Godeps/Godeps.json and go.mod files
+	// found in the workspace.
+	Godeps, Gomod bool
+	// LockFormats import pins from the lock files of other dependency
+	// managers: "glide", "dep" or "vndr".
+	LockFormats []string
+	Log         io.Writer
+}
+
+// SavedRepo is a repository pinned by Save.
+type SavedRepo struct {
+	Dir  string
+	Type string
+	URL  string
+	Rev  string
+}
+
+// Save pins every repository the workspace depends on in .gocfg/vendor.json,
+// records their checksums in .gocfg/vendor.sum, and returns the pins.
+// Dependencies outside the workspace are brought into the vendor gopath.
+func Save(w *workspaces.Workspace, opts SaveOptions) ([]SavedRepo, error) {
+	ws := wrap(w, opts.Log)
+	for _, format := range opts.LockFormats {
+		if _, ok := lockFormats[format]; !ok {
+			return nil, fmt.Errorf("unknown lock file format %q", format)
+		}
+	}
+	plats, err := ws.platforms(opts.Platforms)
+	if err != nil {
+		return nil, err
+	}
+	pkgs, err := ws.outsidePackages(opts.Targets, plats)
+	if err != nil {
+		return nil, err
+	}
+
+	var addons []string
+	for pkg, dir := range pkgs {
+		destination := filepath.Join(ws.vendorRootSrc(), pkg)
+		addons = append(addons, destination+"="+dir)
+	}
+
+	var imported []dirDep
+	if opts.Godeps {
+		imported = append(imported, ws.importGodeps()...)
+	}
+	if opts.Gomod {
+		imported = append(imported, ws.importGomods()...)
+	}
+	for _, format := range opts.LockFormats {
+		dds, err := ws.importLockFiles(format)
+		if err != nil {
+			return nil, err
+		}
+		imported = append(imported, dds...)
+	}
+
+	var rgits, rhgs []string
+	if len(imported) != 0 {
+		for _, dd := range ws.mergeGodeps(imported) {
+			rarg := dd.root + "=" + dd.repo + "@" + dd.rev
+			switch dd.kind {
+			case "git":
+				rgits = append(rgits, rarg)
+			case "hg":
+				rhgs = append(rhgs, rarg)
+			default:
+				ws.logf("unsupported VCS %q\n", dd.kind)
+			}
+		}
+	}
+
+	ignoreDirs := []string{".git", ".hg", ".gocfg"}
+	for _, gopath := range ws.Gopaths {
+		ignoreDirs = append(ignoreDirs,
+			filepath.Join(gopath, "pkg"),
+			filepath.Join(gopath, "bin"))
+	}
+	for _, pattern := range ws.SaveIgnore {
+		matches, err := filepath.Glob(filepath.Join(ws.Root, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("bad ignore pattern %q: %v", pattern, err)
+		}
+		for _, m := range matches {
+			if rel, err := filepath.Rel(ws.Root, m); err == nil {
+				ignoreDirs = append(ignoreDirs, rel)
+			}
+		}
+	}
+	ignored := map[string]bool{}
+	for _, dir := range ignoreDirs {
+		ignored[dir] = true
+	}
+
+	// vend.Save writes vendor.json itself. If vendor.sum can't be brought up
+	// to date to match, the old vendor.json is put back, so the two never
+	// disagree.
+	oldCfg, oldErr := ioutil.ReadFile(ws.vendorConfigPath())
+	vend.Save(ws.Root, ws.vendorConfigPath(), addons, rgits, rhgs, ignored, true)
+	cfg, err := ws.loadVendorConfig()
+	var sums vendorSums
+	if err == nil {
+		sums, err = ws.sumVendorConfig(cfg)
+	}
+	if err == nil {
+		err = sums.write(ws)
+	}
+	if err != nil {
+		if oldErr == nil {
+			ioutil.WriteFile(ws.vendorConfigPath(), oldCfg, 0644)
+		} else if os.IsNotExist(oldErr) {
+			os.Remove(ws.vendorConfigPath())
+		}
+		return nil, err
+	}
+	var saved []SavedRepo
+	for _, dir := range cfg.dirs() {
+		pin := cfg[dir]
+		saved = append(saved, SavedRepo{Dir: dir, Type: pin.Type, URL: pin.URL, Rev: pin.Rev})
+	}
+	return saved, nil
+}
+
+// VendorOptions control Vendor.
+type VendorOptions struct {
+	// Targets are extra packages or patterns whose dependencies are
+	// vendored. With Refresh, they name the vendored copies to refresh, by
+	// directory or import path; all of them if empty.
+	Targets []string
+	// Platforms to collect dependencies for. If empty, the workspace's
+	// configured platforms are used, or else the host.
+	Platforms []Platform
+	// Refresh recopies existing vendored copies instead of adding new ones.
+	Refresh bool
+	// Prune runs Prune once everything is copied.
+	Prune bool
+	// Link is how files are copied: LinkCopy, LinkHard, LinkReflink or
+	// LinkAuto. The default copies.
+	Link string
+	Log  io.Writer
+}
+
+// VendoredPackage is a package copied by Vendor.
+type VendoredPackage struct {
+	ImportPath  string
+	Source      string
+	Destination string
+	Bytes       int64
+	// OldRev and Rev are the source revisions before and after a refresh,
+	// if the package came from a checkout.
+	OldRev string `json:",omitempty"`
+	Rev    string `json:",omitempty"`
+}
+
+// VendorResult is what Vendor did.
+type VendorResult struct {
+	Packages []VendoredPackage
+	Stats    CopyStats
+	// Pruned is set if Prune ran.
+	Pruned *PruneResult `json:",omitempty"`
+}
+
+// Vendor copies the packages the workspace depends on from outside of it
+// into the vendor gopath, and records where they came from in
+// .gocfg/vendored.json. Packages that fail to copy are reported in an Errors,
+// and the rest are still copied.
+func Vendor(w *workspaces.Workspace, opts VendorOptions) (VendorResult, error) {
+	var result VendorResult
+	ws := wrap(w, opts.Log)
+	if opts.Link != "" && !ValidLinkMode(opts.Link) {
+		return result, fmt.Errorf("unknown link mode %q", opts.Link)
+	}
+	copyOpts := ws.copyOptions()
+	copyOpts.Link = opts.Link
+	plats, err := ws.platforms(opts.Platforms)
+	if err != nil {
+		return result, err
+	}
+
+	var errs []error
+	if opts.Refresh {
+		result.Packages, result.Stats, errs = ws.refreshVendored(opts.Targets, copyOpts)
+	} else {
+		result.Packages, result.Stats, errs = ws.vendor(opts.Targets, plats, copyOpts)
+	}
+	if len(errs) != 0 {
+		return result, Errors(errs)
+	}
+	if opts.Prune {
+		pruned, err := ws.prune(false, plats)
+		result.Pruned = &pruned
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func (w *workspace) vendor(targets []string, plats []Platform, opts copyOptions) ([]VendoredPackage, CopyStats, []error) {
+	var total CopyStats
+	copies, err := w.loadVendoredCopies()
+	if err != nil {
+		return nil, total, []error{err}
+	}
+	pkgs, err := w.outsidePackages(targets, plats)
+	if err != nil {
+		return nil, total, []error{err}
+	}
+
+	var vendored []VendoredPackage
+	var errs []error
+	for pkg, dir := range pkgs {
+		destination := filepath.Join(w.vendorRootSrc(), pkg)
+		// if it's already in here, vendor will pick it up
+		if _, err := os.Stat(filepath.Join(w.Root, destination)); err == nil {
+			continue
+		}
+		stats, copyErrs := copyDir(dir, filepath.Join(w.Root, destination), opts)
+		total.add(stats)
+		if len(copyErrs) != 0 {
+			for _, err := range copyErrs {
+				errs = append(errs, &ItemError{Item: pkg, Err: err})
+			}
+			continue
+		}
+		vendored = append(vendored, VendoredPackage{ImportPath: pkg, Source: dir, Destination: destination, Bytes: stats.Bytes})
+		copies[destination] = provenance(pkg, dir)
+	}
+	sort.Slice(vendored, func(i, j int) bool { return vendored[i].ImportPath < vendored[j].ImportPath })
+	if len(vendored) != 0 {
+		if err := copies.write(w); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return vendored, total, errs
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"fmt"
+	"go/build"
+	"os/exec"
+	"strings"
+
+	"github.com/skelterjohn/wgo/workspaces"
+)
+
+// Platform is a GOOS/GOARCH pair, with extra build tags, that dependencies
+// are collected for. The zero Platform is the host, as the go tool sees it.
+type Platform struct {
+	GOOS, GOARCH string
+	Tags         []string
+}
+
+func (p Platform) String() string {
+	if p.GOOS == "" {
+		return "host"
+	}
+	s := p.GOOS + "/" + p.GOARCH
+	if len(p.Tags) != 0 {
+		s += ":" + strings.Join(p.Tags, "+")
+	}
+	return s
+}
+
+// ParsePlatforms parses GOOS/GOARCH pairs, each optionally followed by ":"
+// and build tags joined with "+", like "windows/amd64:netgo+osusergo". Each
+// spec may also be a comma separated list of them.
+func ParsePlatforms(specs []string) ([]Platform, error) {
+	var plats []Platform
+	for _, list := range specs {
+		for _, spec := range strings.Split(list, ",") {
+			spec = strings.TrimSpace(spec)
+			if spec == "" {
+				continue
+			}
+			var p Platform
+			osArch := spec
+			if i := strings.Index(spec, ":"); i >= 0 {
+				osArch = spec[:i]
+				for _, tag := range strings.Split(spec[i+1:], "+") {
+					if tag != "" {
+						p.Tags = append(p.Tags, tag)
+					}
+				}
+			}
+			parts := strings.Split(osArch, "/")
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return nil, fmt.Errorf("bad platform %q; want GOOS/GOARCH", spec)
+			}
+			p.GOOS, p.GOARCH = parts[0], parts[1]
+			plats = append(plats, p)
+		}
+	}
+	return plats, nil
+}
+
+// DefaultPlatforms returns the platforms configured for w, or else just the
+// host. Operations use them when their options name no platforms.
+func DefaultPlatforms(w *workspaces.Workspace) ([]Platform, error) {
+	plats, err := ParsePlatforms(w.Platforms)
+	if err != nil {
+		return nil, err
+	}
+	if len(plats) == 0 {
+		plats = []Platform{{}}
+	}
+	return plats, nil
+}
+
+// platforms returns plats, or the default platforms if there are none.
+func (w *workspace) platforms(plats []Platform) ([]Platform, error) {
+	if len(plats) != 0 {
+		return plats, nil
+	}
+	return DefaultPlatforms(&w.Workspace)
+}
+
+// goListCmd is goCmd for 'go list', with the environment and tags set for p.
+// cgo is enabled, so that cgo files count even when cross-listing.
+func (w *workspace) goListCmd(p Platform, args ...string) (*exec.Cmd, error) {
+	if p.GOOS != "" {
+		tags := append(append([]string(nil), w.BuildTags...), p.Tags...)
+		if len(tags) != 0 {
+			args = append([]string{args[0], "-tags=" + strings.Join(tags, ",")}, args[1:]...)
+		}
+	}
+	cmd, err := w.goCmd(args...)
+	if err != nil {
+		return nil, err
+	}
+	if p.GOOS != "" {
+		cmd.Env = append(cmd.Env, "GOOS="+p.GOOS, "GOARCH="+p.GOARCH, "CGO_ENABLED=1")
+	}
+	return cmd, nil
+}
+
+// buildContext returns a go/build context that matches files for p.
+func (w *workspace) buildContext(p Platform) build.Context {
+	bctx := build.Default
+	bctx.GOPATH = w.Gopath(false)
+	bctx.BuildTags = append(append([]string(nil), w.BuildTags...), p.Tags...)
+	if p.GOOS != "" {
+		bctx.GOOS, bctx.GOARCH = p.GOOS, p.GOARCH
+		bctx.CgoEnabled = true
+	}
+	return bctx
+}
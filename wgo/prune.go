@@ -0,0 +1,403 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/skelterjohn/wgo/workspaces"
+)
+
+// buildSourceExts are the non-Go files a package's build may use.
+var buildSourceExts = map[string]bool{
+	".c": true, ".h": true, ".cc": true, ".cpp": true, ".cxx": true,
+	".hh": true, ".hpp": true, ".hxx": true, ".m": true,
+	".s": true, ".S": true, ".f": true, ".F": true, ".for": true, ".f90": true,
+	".swig": true, ".swigcxx": true, ".syso": true,
+}
+
+// PruneOptions control Prune.
+type PruneOptions struct {
+	// Platforms whose builds must keep working. If empty, the workspace's
+	// configured platforms are used, or else the host.
+	Platforms []Platform
+	// DryRun only lists what would be removed.
+	DryRun bool
+	Log    io.Writer
+}
+
+// PruneResult is what Prune removed, or would remove.
+type PruneResult struct {
+	// Paths are relative to the workspace root.
+	Paths []string
+	Bytes int64
+}
+
+// Prune removes, from every dependency, the packages the workspace does not
+// import, tests, testdata and other files that aren't needed to build. License
+// files are always kept. Paths that can't be removed are reported in an
+// Errors, and are left out of the result.
+func Prune(w *workspaces.Workspace, opts PruneOptions) (PruneResult, error) {
+	ws := wrap(w, opts.Log)
+	plats, err := ws.platforms(opts.Platforms)
+	if err != nil {
+		return PruneResult{}, err
+	}
+	return ws.prune(opts.DryRun, plats)
+}
+
+// prune prunes the dependencies, keeping packages needed on any of plats.
+func (w *workspace) prune(dryRun bool, plats []Platform) (PruneResult, error) {
+	var result PruneResult
+	depDirs, err := w.dependencyDirs()
+	if err != nil {
+		return result, err
+	}
+	rootDirs, err := w.rootPackages(depDirs)
+	if err != nil {
+		return result, err
+	}
+	// The rest of the vendor gopath is only pruned if it can't be holding
+	// the workspace's own code.
+	if vendorSrc := w.separateVendorSrc(); vendorSrc != "" {
+		var own []string
+		for path, dir := range rootDirs {
+			if withinDir(vendorSrc, dir) {
+				own = append(own, path)
+			}
+		}
+		if len(own) == 0 {
+			depDirs = outerDirs(append(depDirs, vendorSrc))
+		} else {
+			sort.Strings(own)
+			w.logf("%s has packages that are not pinned or vendored, like %s; pruning only the pinned repositories and vendored copies\n", w.vendorRootSrc(), own[0])
+		}
+	}
+	if len(depDirs) == 0 {
+		w.logf("no dependencies to prune\n")
+		return result, nil
+	}
+	var roots []string
+	for path := range rootDirs {
+		roots = append(roots, path)
+	}
+	sort.Strings(roots)
+	if len(roots) == 0 {
+		return result, fmt.Errorf("no workspace packages outside the dependencies; refusing to prune everything")
+	}
+
+	keepDirs := map[string]bool{}
+	deps, err := w.listDeps(roots, plats)
+	if err != nil {
+		return result, err
+	}
+	for _, dir := range deps {
+		keepDirs[dir] = true
+	}
+	keepPaths := w.embeddedPaths(keepDirs)
+
+	var removed []string
+	var size int64
+	for _, depDir := range depDirs {
+		paths, n := planPrune(depDir, keepDirs, keepPaths)
+		removed = append(removed, paths...)
+		size += n
+	}
+	sort.Strings(removed)
+
+	rel := func(path string) string {
+		if rel, err := filepath.Rel(w.Root, path); err == nil {
+			return rel
+		}
+		return path
+	}
+	if dryRun {
+		for _, path := range removed {
+			result.Paths = append(result.Paths, rel(path))
+		}
+		result.Bytes = size
+		w.logf("would remove %d paths, %s\n", len(removed), FormatBytes(size))
+		return result, nil
+	}
+
+	var errs []error
+	for _, path := range removed {
+		if err := os.RemoveAll(path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		result.Paths = append(result.Paths, rel(path))
+	}
+	result.Bytes = size
+	for _, depDir := range depDirs {
+		removeEmptyDirs(depDir)
+	}
+	w.logf("removed %d paths, %s\n", len(removed), FormatBytes(size))
+
+	// The pruned repositories no longer match their sums, so record them
+	// again; verify should only catch changes made after the prune.
+	if err := w.updatePrunedSums(result.Paths); err != nil {
+		errs = append(errs, err)
+	}
+	return result, errorsOrNil(errs)
+}
+
+// updatePrunedSums re-records the vendor.sum entries of the pinned repositories
+// that paths, relative to the workspace root, were removed from.
+func (w *workspace) updatePrunedSums(paths []string) error {
+	cfg, err := w.loadVendorConfig()
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var pruned []string
+	for _, dir := range cfg.dirs() {
+		for _, path := range paths {
+			if withinDir(filepath.Join(w.Root, dir), filepath.Join(w.Root, path)) {
+				pruned = append(pruned, dir)
+				break
+			}
+		}
+	}
+	if len(pruned) == 0 {
+		return nil
+	}
+	return w.updateVendorSums(cfg, pruned)
+}
+
+// dependencyDirs returns the absolute directories holding dependencies: the
+// pinned repositories and the vendored copies.
+func (w *workspace) dependencyDirs() ([]string, error) {
+	var dirs []string
+	cfg, err := w.loadVendorConfig()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, dir := range cfg.dirs() {
+		dirs = append(dirs, filepath.Join(w.Root, dir))
+	}
+	copies, err := w.loadVendoredCopies()
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range copies.dirs() {
+		dirs = append(dirs, filepath.Join(w.Root, dir))
+	}
+	return outerDirs(dirs), nil
+}
+
+// outerDirs leaves out the directories inside others, so nothing is walked
+// twice.
+func outerDirs(dirs []string) []string {
+	sort.Strings(dirs)
+	var outer []string
+	for _, dir := range dirs {
+		if len(outer) != 0 && withinDir(outer[len(outer)-1], dir) {
+			continue
+		}
+		outer = append(outer, dir)
+	}
+	return outer
+}
+
+// separateVendorSrc returns the absolute src directory of the vendor gopath,
+// if it exists and is apart from every other gopath, or "" otherwise.
+func (w *workspace) separateVendorSrc() string {
+	vendorSrc := filepath.Join(w.Root, w.vendorRootSrc())
+	if _, err := os.Stat(vendorSrc); err != nil {
+		return ""
+	}
+	others := 0
+	for _, gopath := range w.Gopaths {
+		src := filepath.Join(w.Root, gopath, "src")
+		if src == vendorSrc {
+			continue
+		}
+		if withinDir(src, vendorSrc) || withinDir(vendorSrc, src) {
+			return ""
+		}
+		others++
+	}
+	if others == 0 {
+		return ""
+	}
+	return vendorSrc
+}
+
+// rootPackages finds the packages in the workspace's gopaths that are not
+// inside depDirs, and returns their directories by import path.
+func (w *workspace) rootPackages(depDirs []string) (map[string]string, error) {
+	args := []string{"list", "-e", "-f", "{{.ImportPath}}\t{{.Dir}}"}
+	for _, gopath := range w.Gopaths {
+		args = append(args, "./"+gopath+"/src/...") // filepath.Join() doesn't like a leading dot.
+	}
+	var buf bytes.Buffer
+	cmd, err := w.goCmd(args...)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = &buf
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	roots := map[string]string{}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		fields := strings.SplitN(line, "\t", 2)
+		if len(fields) != 2 || fields[1] == "" {
+			continue
+		}
+		inDeps := false
+		for _, depDir := range depDirs {
+			if withinDir(depDir, fields[1]) {
+				inDeps = true
+				break
+			}
+		}
+		if !inDeps {
+			roots[fields[0]] = fields[1]
+		}
+	}
+	return roots, nil
+}
+
+// embeddedPaths finds the files and directories that the packages in dirs
+// embed with //go:embed.
+func (w *workspace) embeddedPaths(dirs map[string]bool) map[string]bool {
+	bctx := build.Default
+	bctx.GOPATH = w.Gopath(true)
+	paths := map[string]bool{}
+	for dir := range dirs {
+		p, err := bctx.ImportDir(dir, 0)
+		if err != nil {
+			continue
+		}
+		for _, pattern := range p.EmbedPatterns {
+			pattern = strings.TrimPrefix(pattern, "all:")
+			matches, _ := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+			for _, m := range matches {
+				paths[m] = true
+			}
+		}
+	}
+	return paths
+}
+
+// planPrune lists the files and directories in depDir to remove, and their
+// total size. Packages in keepDirs keep their non-test Go files and other
+// build sources, and anything in or under keepPaths is kept whole.
+func planPrune(depDir string, keepDirs, keepPaths map[string]bool) ([]string, int64) {
+	// Directories above a kept path can't be removed whole.
+	protected := map[string]bool{}
+	for path := range keepPaths {
+		for _, parent := range getAllParents(path) {
+			protected[parent] = true
+		}
+	}
+	for dir := range keepDirs {
+		protected[dir] = true
+		for _, parent := range getAllParents(dir) {
+			protected[parent] = true
+		}
+	}
+
+	var removed []string
+	var size int64
+	filepath.Walk(depDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if keepPaths[path] {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if vcsMetadataDirs[name] {
+				return filepath.SkipDir
+			}
+			// The go tool ignores these directories, so nothing builds
+			// from them.
+			ignored := name == "testdata" || strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".")
+			if path != depDir && ignored && !protected[path] {
+				removed = append(removed, path)
+				size += treeSize(path)
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// go.mod marks where a module starts, which export-modules relies
+		// on, and go.sum goes with it.
+		if isLicenseFileName(name) || name == "go.mod" || name == "go.sum" {
+			return nil
+		}
+		if keepDirs[filepath.Dir(path)] && isBuildSource(name) {
+			return nil
+		}
+		removed = append(removed, path)
+		size += info.Size()
+		return nil
+	})
+	return removed, size
+}
+
+// isBuildSource reports whether a file in a package may be needed to build
+// it, for any platform or set of tags.
+func isBuildSource(name string) bool {
+	if strings.HasSuffix(name, ".go") {
+		return !strings.HasSuffix(name, "_test.go")
+	}
+	return buildSourceExts[filepath.Ext(name)]
+}
+
+func treeSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// removeEmptyDirs removes the empty directories below root, deepest first.
+func removeEmptyDirs(root string) {
+	var dirs []string
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() && path != root {
+			if vcsMetadataDirs[info.Name()] {
+				return filepath.SkipDir
+			}
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if fis, err := ioutil.ReadDir(dirs[i]); err == nil && len(fis) == 0 {
+			os.Remove(dirs[i])
+		}
+	}
+}
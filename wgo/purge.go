@@ -0,0 +1,389 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/skelterjohn/wgo/workspaces"
+)
+
+// PurgeOptions control Purge.
+type PurgeOptions struct {
+	// Gopaths are the workspace gopaths to purge; the vendor gopath if
+	// empty.
+	Gopaths []string
+	// Platforms whose builds must keep working. If empty, the workspace's
+	// configured platforms are used, or else the host.
+	Platforms []Platform
+	// NoTests lets Purge remove what only the workspace's tests import.
+	NoTests bool
+	// ByRepo keeps or purges pinned repositories whole, and ByDir works
+	// directory by directory. If neither is set, ByRepo is used when the
+	// workspace has a .gocfg/vendor.json.
+	ByRepo, ByDir bool
+	// Unpin removes the pins of purged repositories. It needs ByRepo.
+	Unpin bool
+	// Confirm moves the directories to the trash. Otherwise Purge only says
+	// what it would do.
+	Confirm bool
+	Log     io.Writer
+}
+
+// PurgeResult is what Purge did, or would do.
+type PurgeResult struct {
+	Actions []PathAction
+	// Trash is the ID of the purge in the trash, for UndoPurge, if anything
+	// was moved there.
+	Trash string `json:",omitempty"`
+}
+
+// PathAction is something Purge or Prune did, or would do, to a path. Action
+// is one of "keep", "purge", "unpin", "trashed", "unpinned", "restored",
+// "prune" and "removed".
+type PathAction struct {
+	Path   string
+	Action string
+	Reason string `json:",omitempty"`
+	// Trash is the ID of the purge in the trash, for UndoPurge.
+	Trash string `json:",omitempty"`
+}
+
+// Purge removes the directories in the given gopaths that hold no source
+// imported, directly or not, from the workspace's other gopaths. The
+// directories are moved to .gocfg/trash, from where UndoPurge can bring them
+// back.
+func Purge(w *workspaces.Workspace, opts PurgeOptions) (PurgeResult, error) {
+	var result PurgeResult
+	ws := wrap(w, opts.Log)
+	if opts.ByRepo && opts.ByDir {
+		return result, fmt.Errorf("cannot purge both by repository and by directory")
+	}
+	plats, err := ws.platforms(opts.Platforms)
+	if err != nil {
+		return result, err
+	}
+	return ws.purge(opts, plats)
+}
+
+func (w *workspace) purge(opts PurgeOptions, plats []Platform) (PurgeResult, error) {
+	var result PurgeResult
+	gopaths := opts.Gopaths
+	tests := !opts.NoTests
+	unpin := opts.Unpin
+	var bctxs []build.Context
+	for _, p := range plats {
+		bctxs = append(bctxs, w.buildContext(p))
+	}
+
+	if len(gopaths) == 0 && len(w.Gopaths) != 0 {
+		gopaths = []string{w.VendorPath()} // By default, this is vendor/.
+	}
+	if len(gopaths) == 0 {
+		return result, fmt.Errorf("must purge at least one GOPATH")
+	}
+	wgps := map[string]bool{}
+	for _, wpg := range w.Gopaths {
+		wgps[wpg] = true
+	}
+	pgs := map[string]bool{}
+	for _, pg := range gopaths {
+		pgs[pg] = true
+		if !wgps[pg] {
+			return result, fmt.Errorf("unknown GOPATH %q", pg)
+		}
+	}
+	if len(gopaths) == len(w.Gopaths) {
+		return result, fmt.Errorf("cannot purge all GOPATHs; try 'rm -r' instead")
+	}
+
+	cfg, err := w.loadVendorConfig()
+	if err != nil && !os.IsNotExist(err) {
+		return result, err
+	}
+	byRepo := opts.ByRepo || (!opts.ByDir && cfg != nil)
+	if byRepo && cfg == nil {
+		return result, fmt.Errorf("purging by repository needs %s", w.vendorConfigPath())
+	}
+	if unpin && !byRepo {
+		return result, fmt.Errorf("unpinning only works when purging by repository")
+	}
+	// In by-repo mode, the pinned repositories are kept or purged whole.
+	pinned := map[string]bool{}
+	if byRepo {
+		for _, dir := range cfg.dirs() {
+			pinned[filepath.Join(w.Root, dir)] = true
+		}
+	}
+
+	// Collect a set of safe directories that will not get purged.
+	safeDirs := []string{}
+	// Keep them in a map too, to protect against loops.
+	safeDirsAll := map[string]bool{}
+	// The directories in the non-purged gopaths are the roots. Every other
+	// safe directory records the one whose imports made it safe, and whether
+	// that was for a root's tests.
+	roots := map[string]bool{}
+	importedBy := map[string]string{}
+	forTests := map[string]bool{}
+	// Start by adding all directories in the non-purged gopaths.
+	for _, wpg := range w.Gopaths {
+		if pgs[wpg] {
+			// skip the purged ones
+			continue
+		}
+		// Only deal with abs paths from here on out, to make checking easier.
+		if !filepath.IsAbs(wpg) {
+			wpg = filepath.Join(w.Root, wpg)
+		}
+		filepath.Walk(filepath.Join(wpg, "src"), func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.IsDir() {
+				safeDirs = append(safeDirs, path)
+				safeDirsAll[path] = true
+				roots[path] = true
+			}
+			return nil
+		})
+	}
+
+	// Go through each safe dir and add its subsafedirs to the end of the list.
+	// Only the roots' tests are followed, since only they are run from the
+	// workspace.
+	for i := 0; i < len(safeDirs); i++ {
+		dir := safeDirs[i]
+		deps, testDeps, err := getDepDirs(bctxs, dir, tests && roots[dir])
+		if err != nil {
+			return result, fmt.Errorf("problem inspecting %s: %v", dir, err)
+		}
+		add := func(d string, test bool) {
+			if safeDirsAll[d] {
+				// cut off cycles
+				return
+			}
+			safeDirs = append(safeDirs, d)
+			safeDirsAll[d] = true
+			importedBy[d] = dir
+			forTests[d] = test
+		}
+		for _, d := range deps {
+			add(d, false)
+		}
+		for _, d := range testDeps {
+			add(d, true)
+		}
+	}
+
+	// Note why each safe directory in the purged gopaths is kept.
+	var kept []string
+	keptWhy := map[string]string{}
+	for _, d := range safeDirs {
+		if roots[d] {
+			continue
+		}
+		rd, err := filepath.Rel(w.Root, d)
+		if err != nil || strings.HasPrefix(rd, "..") {
+			continue
+		}
+		inPurged := false
+		for pg := range pgs {
+			if withinDir(filepath.Join(w.Root, pg, "src"), d) {
+				inPurged = true
+			}
+		}
+		if !inPurged {
+			continue
+		}
+		kept = append(kept, rd)
+		keptWhy[rd] = w.keptReason(d, importedBy, forTests)
+	}
+	sort.Strings(kept)
+
+	// Expand the list of safe dirs to be all parents of safe dirs, to make checking easier later.
+	for dir := range safeDirsAll {
+		for _, parent := range getAllParents(dir) {
+			safeDirsAll[parent] = true
+		}
+	}
+
+	// Armed with a list of safe dirs, go through gopaths and purge those that aren't safe.
+	dirsToPurge := map[string]bool{}
+	for _, pg := range gopaths {
+		if !filepath.IsAbs(pg) {
+			pg = filepath.Join(w.Root, pg)
+		}
+		filepath.Walk(filepath.Join(pg, "src"), func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.IsDir() {
+				return nil
+			}
+			if pinned[path] {
+				// Anything safe inside the repository makes its path safe.
+				if !safeDirsAll[path] {
+					dirsToPurge[path] = true
+				}
+				return filepath.SkipDir
+			}
+			// If this directory is safe, or is the parent of somethinge safe, we keep it.
+			// We stored all the parents of the safe directories so we only need to do a single check here.
+			if safeDirsAll[path] {
+				return nil
+			}
+			// Not safe, will be purged.
+			dirsToPurge[path] = true
+			return nil
+		})
+	}
+
+	for d := range dirsToPurge {
+		// If we're already removing a parent, forget about this directory.
+		pds := getAllParents(d)
+		for _, pd := range pds {
+			if dirsToPurge[pd] {
+				dirsToPurge[d] = false
+			} else {
+				//fmt.Println("no parent", pd, d)
+			}
+		}
+	}
+
+	sortedPurge := []string{}
+	for d, rm := range dirsToPurge {
+		if rm {
+			rd, err := filepath.Rel(w.Root, d)
+			if err != nil {
+				return result, fmt.Errorf("problem with relative path for %q: %v", d, err)
+			}
+			if strings.HasPrefix(rd, "..") {
+				w.logf("skipping path outside of workspace %q\n", d)
+				continue
+			}
+			sortedPurge = append(sortedPurge, rd)
+		}
+	}
+	sort.Strings(sortedPurge)
+
+	for _, d := range kept {
+		result.Actions = append(result.Actions, PathAction{Path: d, Action: "keep", Reason: keptWhy[d]})
+	}
+	if !opts.Confirm {
+		for _, d := range sortedPurge {
+			result.Actions = append(result.Actions, PathAction{Path: d, Action: "purge", Reason: noImportedSource})
+		}
+		if unpin {
+			for _, dir := range cfg.within(w, sortedPurge) {
+				result.Actions = append(result.Actions, PathAction{Path: dir, Action: "unpin", Reason: noImportedSource})
+			}
+		}
+		return result, nil
+	}
+
+	if len(sortedPurge) == 0 {
+		return result, nil
+	}
+	m, errs := w.trashDirs(gopaths, sortedPurge)
+	if unpin && len(m.Paths) != 0 {
+		if err := w.unpinTrashed(cfg, &m); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, d := range m.Paths {
+		result.Actions = append(result.Actions, PathAction{Path: d, Action: "trashed", Reason: noImportedSource, Trash: m.ID})
+	}
+	for _, dir := range m.Pins.dirs() {
+		result.Actions = append(result.Actions, PathAction{Path: dir, Action: "unpinned", Reason: noImportedSource, Trash: m.ID})
+	}
+	if len(m.Paths) != 0 {
+		result.Trash = m.ID
+	}
+	return result, errorsOrNil(errs)
+}
+
+const noImportedSource = "no imported source"
+
+// getDepDirs returns the directories of the packages that the package in dir
+// imports in any of the build contexts. With tests, it also returns the
+// directories of the packages its tests import.
+func getDepDirs(bctxs []build.Context, dir string, tests bool) (deps, testDeps []string, err error) {
+	for _, bctx := range bctxs {
+		pkg, err := bctx.ImportDir(dir, 0)
+		if err != nil {
+			if _, ok := err.(*build.NoGoError); !ok {
+				return nil, nil, err
+			}
+		}
+		for _, imp := range pkg.Imports {
+			depPkg, err := bctx.Import(imp, dir, 0)
+			if err == nil {
+				deps = append(deps, depPkg.Dir)
+			}
+		}
+		if !tests {
+			continue
+		}
+		for _, imp := range append(append([]string(nil), pkg.TestImports...), pkg.XTestImports...) {
+			depPkg, err := bctx.Import(imp, dir, 0)
+			if err == nil && depPkg.Dir != dir {
+				testDeps = append(testDeps, depPkg.Dir)
+			}
+		}
+	}
+	return deps, testDeps, nil
+}
+
+// keptReason describes which root directory's imports keep dir, and through
+// which importer.
+func (w *workspace) keptReason(dir string, importedBy map[string]string, forTests map[string]bool) string {
+	rel := func(d string) string {
+		if r, err := filepath.Rel(w.Root, d); err == nil {
+			return r
+		}
+		return d
+	}
+	// Walk up to the root, remembering the step taken from it.
+	parent := importedBy[dir]
+	root, first := parent, dir
+	for {
+		up, ok := importedBy[root]
+		if !ok {
+			break
+		}
+		root, first = up, root
+	}
+	needed := rel(root)
+	if forTests[first] {
+		needed += "'s tests"
+	}
+	if parent == root {
+		return "imported by " + needed
+	}
+	return fmt.Sprintf("imported by %s, needed by %s", rel(parent), needed)
+}
+
+func getAllParents(dir string) []string {
+	var parents []string
+	for {
+		parent, _ := filepath.Split(dir)
+		parent = filepath.Clean(parent)
+		if parent == dir {
+			return parents
+		}
+		parents = append(parents, parent)
+		dir = parent
+	}
+}
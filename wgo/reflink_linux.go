@@ -0,0 +1,48 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl, _IOW(0x94, 9, int). Architectures that encode
+// ioctls differently reject it, and callers fall back to copying.
+const ficlone = 0x40049409
+
+// reflinkFile makes dst a copy-on-write clone of src, on filesystems that
+// support it, like btrfs and xfs.
+func reflinkFile(finfo os.FileInfo, src, dst string) error {
+	fin, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer fin.Close()
+
+	fout, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, finfo.Mode())
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fout.Fd(), ficlone, fin.Fd())
+	if errno != 0 {
+		fout.Close()
+		os.Remove(dst)
+		return errno
+	}
+	return fout.Close()
+}
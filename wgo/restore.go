@@ -0,0 +1,171 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/skelterjohn/vfu/vend"
+	"github.com/skelterjohn/wgo/workspaces"
+)
+
+// Restore progress states, reported for each repository as it goes.
+const (
+	RestoreFetching    = "fetching"
+	RestoreCheckingOut = "checking out"
+	RestoreDone        = "done"
+	RestoreFailed      = "failed"
+)
+
+// RestoreOptions control Restore.
+type RestoreOptions struct {
+	// NoCache has vfu check out every pinned repository from its origin,
+	// instead of going through the repository cache. vfu prints what it
+	// does to standard output.
+	NoCache bool
+	// Offline only uses what is already in the cache.
+	Offline bool
+	// Jobs is how many repositories are restored at once; the number of
+	// CPUs if zero.
+	Jobs int
+	// Progress, if set, is called as each repository or vendored copy
+	// moves to another state. Calls are never concurrent.
+	Progress func(dir, state string)
+}
+
+// RestoreResult is the outcome for one repository or vendored copy.
+type RestoreResult struct {
+	Dir   string
+	State string
+	Error string `json:",omitempty"`
+}
+
+// Restore checks out every repository pinned in .gocfg/vendor.json at its
+// pinned revision, and recreates vendored copies that have gone missing.
+// Failures are reported in the results and in an Errors of ItemErrors, one
+// per directory, and don't stop the others.
+func Restore(w *workspaces.Workspace, opts RestoreOptions) ([]RestoreResult, error) {
+	ws := wrap(w, nil)
+	c := newRepoCache(CacheDir())
+	c.offline = opts.Offline
+	jobs := opts.Jobs
+	if jobs == 0 {
+		jobs = runtime.NumCPU()
+	}
+	if opts.NoCache {
+		if opts.Offline {
+			return nil, fmt.Errorf("restoring offline needs the cache")
+		}
+		vend.Restore(ws.Root, ws.vendorConfigPath())
+		cfg, err := ws.loadVendorConfig()
+		if err != nil {
+			return nil, err
+		}
+		var results []RestoreResult
+		for _, dir := range cfg.dirs() {
+			results = append(results, RestoreResult{Dir: dir, State: RestoreDone})
+		}
+		return results, nil
+	}
+
+	cfg, err := ws.loadVendorConfig()
+	if os.IsNotExist(err) {
+		// A workspace may only have vendored copies.
+		cfg, err = vendorConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	copies, err := ws.loadVendoredCopies()
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	failures := map[string]error{}
+	report := func(dir, state string) {
+		if opts.Progress == nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		opts.Progress(dir, state)
+	}
+
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for _, dir := range cfg.dirs() {
+		dir, pin := dir, cfg[dir]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			err := ws.restoreFromCache(c, dir, pin, func(state string) {
+				report(dir, state)
+			})
+			if err != nil {
+				report(dir, RestoreFailed)
+				mu.Lock()
+				failures[dir] = err
+				mu.Unlock()
+				return
+			}
+			report(dir, RestoreDone)
+		}()
+	}
+	// Recreate vendored copies that have gone missing.
+	dirs := cfg.dirs()
+	for _, dir := range copies.dirs() {
+		dir, vc := dir, copies[dir]
+		if _, err := os.Stat(filepath.Join(ws.Root, dir)); err == nil {
+			continue
+		}
+		dirs = append(dirs, dir)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			report(dir, RestoreFetching)
+			if err := ws.restoreVendored(c, dir, vc); err != nil {
+				report(dir, RestoreFailed)
+				mu.Lock()
+				failures[dir] = err
+				mu.Unlock()
+				return
+			}
+			report(dir, RestoreDone)
+		}()
+	}
+	wg.Wait()
+
+	var results []RestoreResult
+	var errs []error
+	for _, dir := range dirs {
+		if err, ok := failures[dir]; ok {
+			results = append(results, RestoreResult{Dir: dir, State: RestoreFailed, Error: err.Error()})
+			errs = append(errs, &ItemError{Item: dir, Err: err})
+			continue
+		}
+		results = append(results, RestoreResult{Dir: dir, State: RestoreDone})
+	}
+	return results, errorsOrNil(errs)
+}
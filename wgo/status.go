@@ -0,0 +1,242 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/skelterjohn/wgo/workspaces"
+)
+
+// Repository states, as found by Status.
+const (
+	StatusClean    = "clean"
+	StatusAhead    = "ahead"
+	StatusBehind   = "behind"
+	StatusDiverged = "diverged"
+	StatusMissing  = "missing"
+	StatusUnpinned = "unpinned"
+	StatusError    = "error"
+
+	// States of packages copied in by Vendor.
+	StatusCopied = "copied"
+	StatusStale  = "stale"
+)
+
+// RepoStatus describes how a checked-out repository compares to its pin. For
+// a vendored copy, Pin is where it was copied from.
+type RepoStatus struct {
+	Dir    string
+	State  string
+	Dirty  bool
+	Pin    Pin
+	Rev    string
+	URL    string
+	Reason string
+}
+
+// Drifted reports whether the repository differs from its pin in any way.
+func (s RepoStatus) Drifted() bool {
+	return (s.State != StatusClean && s.State != StatusCopied) || s.Dirty || s.urlChanged()
+}
+
+// urlChanged reports whether the checkout's origin differs from the pinned
+// URL.
+func (s RepoStatus) urlChanged() bool {
+	switch s.State {
+	case StatusMissing, StatusUnpinned, StatusError, StatusCopied, StatusStale:
+		return false
+	}
+	return s.Pin.URL != "" && s.URL != s.Pin.URL
+}
+
+func (s RepoStatus) String() string {
+	state := s.State
+	if s.Dirty {
+		state += ",dirty"
+	}
+	var notes []string
+	switch s.State {
+	case StatusAhead, StatusBehind, StatusDiverged:
+		notes = append(notes, fmt.Sprintf("pinned %s, at %s", ShortRev(s.Pin.Rev), ShortRev(s.Rev)))
+	case StatusStale:
+		notes = append(notes, fmt.Sprintf("copied at %s, source at %s", ShortRev(s.Pin.Rev), ShortRev(s.Rev)))
+	case StatusError:
+		notes = append(notes, s.Reason)
+	}
+	if s.urlChanged() {
+		notes = append(notes, fmt.Sprintf("origin %q, pinned %q", s.URL, s.Pin.URL))
+	}
+	line := fmt.Sprintf("%-16s %s", state, s.Dir)
+	if len(notes) != 0 {
+		line += " (" + strings.Join(notes, "; ") + ")"
+	}
+	return line
+}
+
+// ShortRev abbreviates a revision for display.
+func ShortRev(rev string) string {
+	if len(rev) > 12 {
+		return rev[:12]
+	}
+	return rev
+}
+
+// checkPin compares the repository at dir, relative to the workspace root,
+// against its pin.
+func (w *workspace) checkPin(dir string, pin Pin) RepoStatus {
+	s := RepoStatus{
+		Dir: dir,
+		Pin: pin,
+	}
+	absDir := filepath.Join(w.Root, dir)
+	if _, err := os.Stat(absDir); err != nil {
+		s.State = StatusMissing
+		return s
+	}
+	kind := vcsKindOf(absDir)
+	if kind == "" {
+		s.State = StatusMissing
+		return s
+	}
+
+	fail := func(err error) RepoStatus {
+		s.State = StatusError
+		s.Reason = err.Error()
+		return s
+	}
+
+	var err error
+	if s.Rev, err = vcsHead(kind, absDir); err != nil {
+		return fail(err)
+	}
+	if s.Dirty, err = vcsDirty(kind, absDir); err != nil {
+		return fail(err)
+	}
+	if s.URL, err = vcsOrigin(kind, absDir); err != nil {
+		// A checkout without an origin can't match the pinned URL.
+		s.URL = ""
+	}
+
+	if !vcsHasRev(kind, absDir, pin.Rev) {
+		// The pin refers to something that has not been fetched yet.
+		s.State = StatusBehind
+		return s
+	}
+	// Pins may be tags or branches, so compare the revisions they name.
+	pinRev, err := vcsResolveRev(kind, absDir, pin.Rev)
+	if err != nil {
+		return fail(err)
+	}
+	switch {
+	case SameRev(s.Rev, pinRev):
+		s.State = StatusClean
+	default:
+		ahead, err := vcsIsAncestor(kind, absDir, pinRev, s.Rev)
+		if err != nil {
+			return fail(err)
+		}
+		behind, err := vcsIsAncestor(kind, absDir, s.Rev, pinRev)
+		if err != nil {
+			return fail(err)
+		}
+		switch {
+		case ahead:
+			s.State = StatusAhead
+		case behind:
+			s.State = StatusBehind
+		default:
+			s.State = StatusDiverged
+		}
+	}
+	return s
+}
+
+// checkCopy compares a package copied in by 'wgo vendor' with its source.
+func (w *workspace) checkCopy(dir string, vc vendoredCopy) RepoStatus {
+	s := RepoStatus{
+		Dir:   dir,
+		State: StatusCopied,
+		Pin:   Pin{Type: vc.Type, URL: vc.URL, Rev: vc.Rev},
+	}
+	if _, err := os.Stat(filepath.Join(w.Root, dir)); err != nil {
+		s.State = StatusMissing
+		return s
+	}
+	if s.Rev = vc.sourceRev(); s.Rev != "" && vc.Rev != "" && !SameRev(s.Rev, vc.Rev) {
+		s.State = StatusStale
+	}
+	return s
+}
+
+// unpinnedRepos finds repositories under the vendor gopath that are not
+// recorded in cfg.
+func (w *workspace) unpinnedRepos(cfg vendorConfig) []string {
+	var found []string
+	srcDir := filepath.Join(w.Root, w.vendorRootSrc())
+	filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if vcsKindOf(path) == "" {
+			return nil
+		}
+		rel, err := filepath.Rel(w.Root, path)
+		if err != nil {
+			return nil
+		}
+		if _, ok := cfg[rel]; !ok {
+			found = append(found, rel)
+		}
+		// Nested checkouts belong to the outer repository.
+		return filepath.SkipDir
+	})
+	sort.Strings(found)
+	return found
+}
+
+// Status reports how the repositories on disk compare to the pins in
+// .gocfg/vendor.json and to the sources of vendored copies, and lists
+// repositories in the vendor gopath that aren't pinned.
+func Status(w *workspaces.Workspace) ([]RepoStatus, error) {
+	ws := wrap(w, nil)
+	cfg, err := ws.loadVendorConfig()
+	if os.IsNotExist(err) {
+		// A workspace may only have vendored copies.
+		cfg, err = vendorConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []RepoStatus
+	for _, dir := range cfg.dirs() {
+		statuses = append(statuses, ws.checkPin(dir, cfg[dir]))
+	}
+	copies, err := ws.loadVendoredCopies()
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range copies.dirs() {
+		statuses = append(statuses, ws.checkCopy(dir, copies[dir]))
+	}
+	for _, dir := range ws.unpinnedRepos(cfg) {
+		statuses = append(statuses, RepoStatus{Dir: dir, State: StatusUnpinned})
+	}
+	return statuses, nil
+}
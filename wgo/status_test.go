@@ -0,0 +1,55 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/skelterjohn/wgo/workspaces"
+)
+
+func TestCheckPinTag(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root, err := ioutil.TempDir("", "wgo-status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	dir := filepath.Join("vendor", "src", "example.com", "a")
+	repo := filepath.Join(root, dir)
+	git(t, root, "init", "--quiet", repo)
+	git(t, repo, "commit", "--quiet", "--allow-empty", "-m", "first")
+	git(t, repo, "tag", "v1.0.0")
+	git(t, repo, "tag", "-a", "-m", "annotated", "v1.0.1")
+
+	ws := wrap(&workspaces.Workspace{Root: root}, nil)
+	for _, tag := range []string{"v1.0.0", "v1.0.1"} {
+		s := ws.checkPin(dir, Pin{Type: "git", Rev: tag})
+		if s.State != StatusClean {
+			t.Errorf("pinned to %s at that tag: got %s, want %s", tag, s.State, StatusClean)
+		}
+	}
+
+	git(t, repo, "commit", "--quiet", "--allow-empty", "-m", "second")
+	if s := ws.checkPin(dir, Pin{Type: "git", Rev: "v1.0.0"}); s.State != StatusAhead {
+		t.Errorf("pinned to v1.0.0 one commit later: got %s, want %s", s.State, StatusAhead)
+	}
+}
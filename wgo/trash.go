@@ -0,0 +1,336 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skelterjohn/wgo/workspaces"
+)
+
+const trashManifestName = "manifest.json"
+
+// trashManifest records what one confirmed purge moved to the trash. It is
+// stored in .gocfg/trash/<ID>/manifest.json, next to a "files" directory that
+// holds the purged directories at their paths relative to the workspace root.
+type trashManifest struct {
+	ID     string
+	Time   time.Time
+	Gopath []string
+	// Paths are the purged directories, relative to the workspace root.
+	Paths []string
+	// Pins and Sums are the entries that 'wgo purge --unpin' removed from
+	// vendor.json and vendor.sum, to be put back by an undo.
+	Pins vendorConfig `json:",omitempty"`
+	Sums vendorSums   `json:",omitempty"`
+}
+
+func (w *workspace) trashPath() string {
+	return filepath.Join(w.Root, workspaces.ConfigDirName, "trash")
+}
+
+// trashIDs lists the IDs of the purges in the trash, oldest first.
+func (w *workspace) trashIDs() ([]string, error) {
+	fis, err := ioutil.ReadDir(w.trashPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, fi := range fis {
+		if fi.IsDir() && !strings.HasPrefix(fi.Name(), ".") {
+			ids = append(ids, fi.Name())
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return trashIDLess(ids[i], ids[j]) })
+	return ids, nil
+}
+
+// trashIDLess orders trash IDs by time, and then by the number trashDirs adds
+// to tell apart purges made in the same second, so that "-10" comes after
+// "-9".
+func trashIDLess(a, b string) bool {
+	split := func(id string) (string, int) {
+		i := strings.LastIndex(id, "-")
+		if i < 0 {
+			return id, 0
+		}
+		n, err := strconv.Atoi(id[i+1:])
+		if err != nil {
+			return id, 0
+		}
+		return id[:i], n
+	}
+	aTime, aN := split(a)
+	bTime, bN := split(b)
+	if aTime != bTime {
+		return aTime < bTime
+	}
+	return aN < bN
+}
+
+func (w *workspace) loadTrashManifest(id string) (trashManifest, error) {
+	var m trashManifest
+	path := filepath.Join(w.trashPath(), id, trashManifestName)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, fmt.Errorf("no purge %q in the trash", id)
+	}
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+func (m trashManifest) write(w *workspace) error {
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	return ioutil.WriteFile(filepath.Join(w.trashPath(), m.ID, trashManifestName), data, 0644)
+}
+
+// trashDirs moves the directories at paths, relative to the workspace root,
+// into a new entry in the trash and returns its manifest. Every directory that
+// can be moved is, and the manifest lists only those; the errors for the
+// others are returned with it.
+func (w *workspace) trashDirs(gopaths, paths []string) (trashManifest, []error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	m := trashManifest{
+		ID:     now.Format("20060102T150405Z"),
+		Time:   now,
+		Gopath: gopaths,
+	}
+	// Two purges in the same second get distinct entries.
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(filepath.Join(w.trashPath(), m.ID)); os.IsNotExist(err) {
+			break
+		}
+		m.ID = fmt.Sprintf("%s-%d", now.Format("20060102T150405Z"), i)
+	}
+	files := filepath.Join(w.trashPath(), m.ID, "files")
+	if err := os.MkdirAll(files, 0755); err != nil {
+		return m, []error{err}
+	}
+
+	var errs []error
+	for _, path := range paths {
+		if err := moveDir(filepath.Join(w.Root, path), filepath.Join(files, path)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		m.Paths = append(m.Paths, path)
+	}
+	if err := m.write(w); err != nil {
+		errs = append(errs, err)
+	}
+	return m, errs
+}
+
+// untrash moves the directories of the purge id back where they were, and
+// returns the ones it restored. A directory is not restored over something
+// that has since been put in its place. The purge is removed from the trash
+// once everything is back.
+func (w *workspace) untrash(id string) (trashManifest, []string, []error) {
+	m, err := w.loadTrashManifest(id)
+	if err != nil {
+		return m, nil, []error{err}
+	}
+	files := filepath.Join(w.trashPath(), m.ID, "files")
+	var restored, left []string
+	var errs []error
+	for _, path := range m.Paths {
+		dst := filepath.Join(w.Root, path)
+		if _, err := os.Lstat(dst); err == nil {
+			errs = append(errs, fmt.Errorf("not restoring %s: it already exists", path))
+			left = append(left, path)
+			continue
+		}
+		if err := moveDir(filepath.Join(files, path), dst); err != nil {
+			errs = append(errs, err)
+			left = append(left, path)
+			continue
+		}
+		restored = append(restored, path)
+	}
+	if len(m.Pins) != 0 {
+		if err := w.repinRestored(&m, left); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(left) != 0 {
+		m.Paths = left
+		if err := m.write(w); err != nil {
+			errs = append(errs, err)
+		}
+		return m, restored, errs
+	}
+	if err := os.RemoveAll(filepath.Join(w.trashPath(), m.ID)); err != nil {
+		errs = append(errs, err)
+	}
+	return m, restored, errs
+}
+
+// unpinTrashed removes the pins of the repositories trashed in m from cfg
+// and vendor.sum, and records them in m so they can be restored.
+func (w *workspace) unpinTrashed(cfg vendorConfig, m *trashManifest) error {
+	dirs := cfg.within(w, m.Paths)
+	if len(dirs) == 0 {
+		return nil
+	}
+	sums, err := w.loadVendorSums()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	m.Pins = vendorConfig{}
+	for _, dir := range dirs {
+		m.Pins[dir] = cfg[dir]
+		delete(cfg, dir)
+		if ts, ok := sums[dir]; ok {
+			if m.Sums == nil {
+				m.Sums = vendorSums{}
+			}
+			m.Sums[dir] = ts
+			delete(sums, dir)
+		}
+	}
+	if err := cfg.write(w); err != nil {
+		return err
+	}
+	if sums != nil {
+		if err := sums.write(w); err != nil {
+			return err
+		}
+	}
+	w.logf("unpinned %d repositories\n", len(dirs))
+	return m.write(w)
+}
+
+// repinRestored puts back the pins in m whose repositories are no longer in
+// the trash, that is, not in left.
+func (w *workspace) repinRestored(m *trashManifest, left []string) error {
+	cfg, err := w.loadVendorConfig()
+	if os.IsNotExist(err) {
+		cfg, err = vendorConfig{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	sums, err := w.loadVendorSums()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	stillTrashed := m.Pins.within(w, left)
+	trashed := map[string]bool{}
+	for _, dir := range stillTrashed {
+		trashed[dir] = true
+	}
+	for dir, pin := range m.Pins {
+		if trashed[dir] {
+			continue
+		}
+		cfg[dir] = pin
+		delete(m.Pins, dir)
+		if ts, ok := m.Sums[dir]; ok && sums != nil {
+			sums[dir] = ts
+		}
+		delete(m.Sums, dir)
+	}
+	if err := cfg.write(w); err != nil {
+		return err
+	}
+	if sums != nil {
+		return sums.write(w)
+	}
+	return nil
+}
+
+// moveDir renames src to dst, creating dst's parents. If they are on
+// different devices, src is copied and then removed.
+func moveDir(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	if !isCrossDevice(err) {
+		return err
+	}
+	if _, errs := copyDir(src, dst, copyOptions{}); len(errs) != 0 {
+		return copyError(errs)
+	}
+	return os.RemoveAll(src)
+}
+
+// UndoResult is what UndoPurge restored.
+type UndoResult struct {
+	// ID is the purge that was undone.
+	ID   string
+	Time time.Time
+	// Restored are the directories moved back, relative to the workspace
+	// root.
+	Restored []string
+}
+
+// UndoPurge moves the directories of the purge with the given ID, or of the
+// latest purge if id is empty, back from the trash, and restores any pins it
+// removed. If some can't be moved back, they are left in the trash, and the
+// returned Errors says why.
+func UndoPurge(w *workspaces.Workspace, id string) (UndoResult, error) {
+	ws := wrap(w, nil)
+	if id == "" {
+		ids, err := ws.trashIDs()
+		if err != nil {
+			return UndoResult{}, err
+		}
+		if len(ids) == 0 {
+			return UndoResult{}, fmt.Errorf("the trash is empty; nothing to undo")
+		}
+		id = ids[len(ids)-1]
+	}
+	m, restored, errs := ws.untrash(id)
+	result := UndoResult{ID: id, Time: m.Time, Restored: restored}
+	if len(errs) != 0 {
+		errs = append(errs, fmt.Errorf("purge %s was not completely undone; what is left is in %s", id, filepath.Join(ws.trashPath(), id)))
+		return result, Errors(errs)
+	}
+	return result, nil
+}
+
+// EmptyTrash removes every purge from the trash, and returns how many bytes
+// that freed.
+func EmptyTrash(w *workspaces.Workspace) (int64, error) {
+	ws := wrap(w, nil)
+	size := treeSize(ws.trashPath())
+	if err := os.RemoveAll(ws.trashPath()); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
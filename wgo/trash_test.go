@@ -0,0 +1,41 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestTrashIDOrder(t *testing.T) {
+	ids := []string{
+		"20160102T150405Z-10",
+		"20160102T150406Z",
+		"20160102T150405Z-2",
+		"20160102T150405Z",
+		"20160102T150405Z-1",
+	}
+	sort.Slice(ids, func(i, j int) bool { return trashIDLess(ids[i], ids[j]) })
+	want := []string{
+		"20160102T150405Z",
+		"20160102T150405Z-1",
+		"20160102T150405Z-2",
+		"20160102T150405Z-10",
+		"20160102T150406Z",
+	}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("got %q, want %q", ids, want)
+	}
+}
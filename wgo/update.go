@@ -0,0 +1,317 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/skelterjohn/wgo/workspaces"
+	"golang.org/x/mod/semver"
+)
+
+// pinUpdate is a pinned repository being moved to a new revision.
+type pinUpdate struct {
+	dir    string
+	absDir string
+	pin    Pin
+	spec   string
+	newRev string
+	// oldHead is what was checked out before the update, to go back to if
+	// the update fails.
+	oldHead string
+}
+
+// UpdateOptions control Update.
+type UpdateOptions struct {
+	// Specs select the pins to update, as a repository directory or import
+	// path, optionally followed by "@" and a tag, branch, revision or semver
+	// constraint like "^1.2". Without one, a pin moves to the tip of the
+	// default branch. All pins are updated if there are no specs.
+	Specs []string
+	// Log gets the output of the build that checks the updates.
+	Log io.Writer
+}
+
+// UpdatedPin is a pin that Update moved.
+type UpdatedPin struct {
+	Dir      string
+	From, To string
+	// Changes are the commits between From and To, one line each.
+	Changes []string
+	// ChangesErr is why Changes couldn't be listed, if they couldn't.
+	ChangesErr error `json:"-"`
+}
+
+// Update moves pins forward: it advances each selected repository, checks
+// that the workspace still builds, and only then records the new revisions
+// in .gocfg/vendor.json and .gocfg/vendor.sum. If anything fails, the
+// checkouts are put back and nothing is recorded.
+func Update(w *workspaces.Workspace, opts UpdateOptions) ([]UpdatedPin, error) {
+	ws := wrap(w, opts.Log)
+	cfg, err := ws.loadVendorConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []*pinUpdate
+	if len(opts.Specs) == 0 {
+		for _, dir := range cfg.dirs() {
+			updates = append(updates, &pinUpdate{dir: dir, pin: cfg[dir]})
+		}
+	}
+	for _, arg := range opts.Specs {
+		name, spec := arg, ""
+		if i := strings.LastIndex(arg, "@"); i >= 0 {
+			name, spec = arg[:i], arg[i+1:]
+		}
+		dir, ok := ws.findPin(cfg, name)
+		if !ok {
+			return nil, fmt.Errorf("%q is not pinned in %s", name, ws.vendorConfigPath())
+		}
+		updates = append(updates, &pinUpdate{dir: dir, pin: cfg[dir], spec: spec})
+	}
+
+	// Move every checkout first, so the build sees all of the updates
+	// together.
+	var moved []*pinUpdate
+	rollback := func() {
+		for _, u := range updates {
+			if u.oldHead == "" {
+				continue
+			}
+			if err := vcsCheckout(u.pin.Type, u.absDir, u.oldHead); err != nil {
+				ws.logf("%s: could not go back to %s: %s\n", u.dir, u.oldHead, err)
+			}
+		}
+	}
+	for _, u := range updates {
+		u.absDir = filepath.Join(ws.Root, u.dir)
+		if err := u.advance(); err != nil {
+			rollback()
+			return nil, fmt.Errorf("%s: %s", u.dir, err)
+		}
+		if !SameRev(u.newRev, u.pin.Rev) {
+			moved = append(moved, u)
+		}
+	}
+	if len(moved) == 0 {
+		return nil, nil
+	}
+
+	if err := ws.buildAll(); err != nil {
+		rollback()
+		return nil, fmt.Errorf("the workspace does not build with the updates (%s); %s is unchanged", err, ws.vendorConfigPath())
+	}
+
+	for _, u := range moved {
+		pin := u.pin
+		pin.Rev = u.newRev
+		cfg[u.dir] = pin
+	}
+	if err := cfg.write(ws); err != nil {
+		return nil, err
+	}
+	var movedDirs []string
+	for _, u := range moved {
+		movedDirs = append(movedDirs, u.dir)
+	}
+	if err := ws.updateVendorSums(cfg, movedDirs); err != nil {
+		return nil, err
+	}
+
+	var updated []UpdatedPin
+	for _, u := range moved {
+		changes, err := vcsLog(u.pin.Type, u.absDir, u.pin.Rev, u.newRev)
+		updated = append(updated, UpdatedPin{
+			Dir:        u.dir,
+			From:       u.pin.Rev,
+			To:         u.newRev,
+			Changes:    changes,
+			ChangesErr: err,
+		})
+	}
+	return updated, nil
+}
+
+// advance fetches the repository and checks out the revision its spec
+// selects.
+func (u *pinUpdate) advance() error {
+	kind := u.pin.Type
+	if vcsKindOf(u.absDir) != kind {
+		return fmt.Errorf("not a %s checkout; run 'wgo restore' first", kind)
+	}
+	head, err := vcsHeadRef(kind, u.absDir)
+	if err != nil {
+		return err
+	}
+	if err := vcsFetch(kind, u.absDir); err != nil {
+		return err
+	}
+
+	var rev string
+	switch {
+	case u.spec == "":
+		rev, err = vcsDefaultTip(kind, u.absDir)
+	case isVersionConstraint(u.spec):
+		var tag string
+		if tag, err = newestMatchingTag(kind, u.absDir, u.spec); err == nil {
+			rev, err = vcsResolveRev(kind, u.absDir, tag)
+		}
+	default:
+		// A tag, branch or revision.
+		rev, err = vcsResolveFetched(kind, u.absDir, u.spec)
+	}
+	if err != nil {
+		return err
+	}
+	u.newRev = rev
+	u.oldHead = head
+	return vcsCheckout(kind, u.absDir, rev)
+}
+
+// buildAll builds every package in the workspace's non-vendor gopaths. If the
+// vendor gopath is the only one, the workspace's own code is in it too, so
+// all of it is built.
+func (w *workspace) buildAll() error {
+	var gopaths []string
+	for _, gopath := range w.Gopaths {
+		if gopath != w.VendorPath() {
+			gopaths = append(gopaths, gopath)
+		}
+	}
+	if len(gopaths) == 0 {
+		gopaths = w.Gopaths
+	}
+	if len(gopaths) == 0 {
+		w.logf("the workspace has no gopaths; not checking that it builds\n")
+		return nil
+	}
+	args := []string{"build"}
+	for _, gopath := range gopaths {
+		args = append(args, "./"+gopath+"/src/...") // filepath.Join() doesn't like a leading dot.
+	}
+	cmd, err := w.goCmd(args...)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = w.log
+	cmd.Stderr = w.log
+	return cmd.Run()
+}
+
+// isVersionConstraint reports whether spec is a semver constraint like
+// "^1.2", ">=1.3.0, <2", or "~0.4.1", rather than a specific revision.
+func isVersionConstraint(spec string) bool {
+	return strings.ContainsAny(spec[:1], "^~<>=")
+}
+
+// newestMatchingTag returns the newest release tag that satisfies every
+// clause of constraint.
+func newestMatchingTag(kind, dir, constraint string) (string, error) {
+	tests, err := parseConstraint(constraint)
+	if err != nil {
+		return "", err
+	}
+	tags, err := vcsTags(kind, dir)
+	if err != nil {
+		return "", err
+	}
+	var matching []string
+	for _, tag := range tags {
+		v := canonicalVersion(tag)
+		if v == "" {
+			continue
+		}
+		ok := true
+		for _, test := range tests {
+			ok = ok && test(v)
+		}
+		if ok {
+			matching = append(matching, tag)
+		}
+	}
+	best := newestVersionTag(matching)
+	if best == "" {
+		return "", fmt.Errorf("no tag matches %q", constraint)
+	}
+	return best, nil
+}
+
+// canonicalVersion turns a tag like "1.2" or "v1.2.0" into "v1.2.0", or "" if
+// it is not a version.
+func canonicalVersion(tag string) string {
+	if !strings.HasPrefix(tag, "v") {
+		tag = "v" + tag
+	}
+	return semver.Canonical(tag)
+}
+
+// parseConstraint parses comma or space separated clauses, each an operator
+// (^, ~, >=, >, <=, < or =) followed by a version.
+func parseConstraint(constraint string) ([]func(string) bool, error) {
+	var tests []func(string) bool
+	for _, clause := range strings.FieldsFunc(constraint, func(r rune) bool { return r == ',' || r == ' ' }) {
+		op := strings.TrimRight(clause, "v0123456789.")
+		v := canonicalVersion(clause[len(op):])
+		if v == "" {
+			return nil, fmt.Errorf("bad version in %q", clause)
+		}
+		cmp := func(pred func(int) bool) func(string) bool {
+			return func(tag string) bool { return pred(semver.Compare(tag, v)) }
+		}
+		switch op {
+		case "^", "~":
+			upper := nextVersion(v, op)
+			tests = append(tests,
+				cmp(func(c int) bool { return c >= 0 }),
+				func(tag string) bool { return semver.Compare(tag, upper) < 0 })
+		case ">=":
+			tests = append(tests, cmp(func(c int) bool { return c >= 0 }))
+		case ">":
+			tests = append(tests, cmp(func(c int) bool { return c > 0 }))
+		case "<=":
+			tests = append(tests, cmp(func(c int) bool { return c <= 0 }))
+		case "<":
+			tests = append(tests, cmp(func(c int) bool { return c < 0 }))
+		case "=", "":
+			tests = append(tests, cmp(func(c int) bool { return c == 0 }))
+		default:
+			return nil, fmt.Errorf("bad operator in %q", clause)
+		}
+	}
+	return tests, nil
+}
+
+// nextVersion returns the first version excluded by a ^ or ~ constraint on v.
+// ^ allows changes that do not modify the left-most non-zero component, and
+// ~ allows patch-level changes.
+func nextVersion(v, op string) string {
+	parts := strings.SplitN(strings.TrimPrefix(v, "v"), ".", 3)
+	nums := make([]int, 3)
+	for i := range nums {
+		nums[i], _ = strconv.Atoi(parts[i])
+	}
+	switch {
+	case op == "~" || nums[0] == 0 && nums[1] != 0:
+		return fmt.Sprintf("v%d.%d.0", nums[0], nums[1]+1)
+	case nums[0] == 0:
+		return fmt.Sprintf("v0.0.%d", nums[2]+1)
+	default:
+		return fmt.Sprintf("v%d.0.0", nums[0]+1)
+	}
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// vcsOutput runs a version control command in dir and returns its trimmed
+// standard output.
+func vcsOutput(dir, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", fmt.Errorf("%s %s: %v", name, strings.Join(args, " "), err)
+		}
+		return "", fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// vcsKindOf reports which version control system manages the checkout at dir,
+// or "" if dir is not the root of a checkout.
+func vcsKindOf(dir string) string {
+	for _, kind := range []string{"git", "hg"} {
+		if _, err := os.Stat(filepath.Join(dir, "."+kind)); err == nil {
+			return kind
+		}
+	}
+	return ""
+}
+
+// vcsHead returns the revision currently checked out in dir.
+func vcsHead(kind, dir string) (string, error) {
+	switch kind {
+	case "git":
+		return vcsOutput(dir, "git", "rev-parse", "HEAD")
+	case "hg":
+		return vcsOutput(dir, "hg", "log", "-r", ".", "--template", "{node}")
+	}
+	return "", fmt.Errorf("unsupported VCS %q", kind)
+}
+
+// vcsHeadRef returns what is checked out in dir in a form vcsCheckout takes
+// back: the branch, if git has one checked out, or else the revision.
+func vcsHeadRef(kind, dir string) (string, error) {
+	if kind == "git" {
+		if branch, err := vcsOutput(dir, "git", "symbolic-ref", "--quiet", "--short", "HEAD"); err == nil && branch != "" {
+			return branch, nil
+		}
+	}
+	return vcsHead(kind, dir)
+}
+
+// vcsTrackedFiles lists the files the checkout in dir tracks, as slash
+// separated paths relative to dir.
+func vcsTrackedFiles(kind, dir string) ([]string, error) {
+	var out string
+	var err error
+	switch kind {
+	case "git":
+		out, err = vcsOutput(dir, "git", "ls-files", "-z")
+	case "hg":
+		out, err = vcsOutput(dir, "hg", "files", "-0")
+	default:
+		return nil, fmt.Errorf("unsupported VCS %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, f := range strings.Split(out, "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// vcsDirty reports whether the checkout in dir has uncommitted changes.
+func vcsDirty(kind, dir string) (bool, error) {
+	var out string
+	var err error
+	switch kind {
+	case "git":
+		out, err = vcsOutput(dir, "git", "status", "--porcelain")
+	case "hg":
+		out, err = vcsOutput(dir, "hg", "status")
+	default:
+		return false, fmt.Errorf("unsupported VCS %q", kind)
+	}
+	return out != "", err
+}
+
+// vcsOrigin returns the URL the checkout in dir was cloned from.
+func vcsOrigin(kind, dir string) (string, error) {
+	switch kind {
+	case "git":
+		return vcsOutput(dir, "git", "config", "--get", "remote.origin.url")
+	case "hg":
+		return vcsOutput(dir, "hg", "paths", "default")
+	}
+	return "", fmt.Errorf("unsupported VCS %q", kind)
+}
+
+// vcsHasRev reports whether rev is known to the checkout in dir.
+func vcsHasRev(kind, dir, rev string) bool {
+	var err error
+	switch kind {
+	case "git":
+		_, err = vcsOutput(dir, "git", "cat-file", "-e", rev+"^{commit}")
+	case "hg":
+		_, err = vcsOutput(dir, "hg", "log", "-r", rev, "--template", "{node}")
+	default:
+		return false
+	}
+	return err == nil
+}
+
+// vcsIsAncestor reports whether revision a is an ancestor of revision b in the
+// checkout in dir.
+func vcsIsAncestor(kind, dir, a, b string) (bool, error) {
+	switch kind {
+	case "git":
+		cmd := exec.Command("git", "merge-base", "--is-ancestor", a, b)
+		cmd.Dir = dir
+		err := cmd.Run()
+		if err == nil {
+			return true, nil
+		}
+		if _, ok := err.(*exec.ExitError); ok {
+			return false, nil
+		}
+		return false, err
+	case "hg":
+		out, err := vcsOutput(dir, "hg", "log", "-r", fmt.Sprintf("%s and ancestors(%s)", a, b), "--template", "{node}")
+		return out != "", err
+	}
+	return false, fmt.Errorf("unsupported VCS %q", kind)
+}
+
+// SameRev reports whether two revision identifiers name the same revision,
+// allowing either of them to be abbreviated.
+func SameRev(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+// vcsFetch brings the checkout in dir up to date with its origin, without
+// changing what is checked out.
+func vcsFetch(kind, dir string) error {
+	var err error
+	switch kind {
+	case "git":
+		_, err = vcsOutput(dir, "git", "fetch", "--quiet", "--tags", "origin")
+		if err == nil {
+			// Make sure origin/HEAD tracks the remote's default branch.
+			_, err = vcsOutput(dir, "git", "remote", "set-head", "origin", "--auto")
+		}
+	case "hg":
+		_, err = vcsOutput(dir, "hg", "pull", "--quiet")
+	default:
+		err = fmt.Errorf("unsupported VCS %q", kind)
+	}
+	return err
+}
+
+// vcsFetchRev brings rev, and the history leading to it, from url into the
+// checkout in dir. No branches or tags are changed.
+func vcsFetchRev(kind, dir, url, rev string) error {
+	var err error
+	switch kind {
+	case "git":
+		_, err = vcsOutput(dir, "git", "fetch", "--quiet", url, rev)
+	case "hg":
+		_, err = vcsOutput(dir, "hg", "pull", "--quiet", "-r", rev, url)
+	default:
+		err = fmt.Errorf("unsupported VCS %q", kind)
+	}
+	return err
+}
+
+// vcsDefaultTip returns the newest revision on the default branch of the
+// checkout's origin, as of the last fetch.
+func vcsDefaultTip(kind, dir string) (string, error) {
+	switch kind {
+	case "git":
+		return vcsOutput(dir, "git", "rev-parse", "refs/remotes/origin/HEAD")
+	case "hg":
+		return vcsOutput(dir, "hg", "log", "-r", "max(branch(default))", "--template", "{node}")
+	}
+	return "", fmt.Errorf("unsupported VCS %q", kind)
+}
+
+// vcsResolveFetched resolves a branch, tag or revision after vcsFetch. A git
+// branch resolves to the origin's, since the local branch of the same name
+// may be stale.
+func vcsResolveFetched(kind, dir, spec string) (string, error) {
+	if kind == "git" {
+		if rev, err := vcsResolveRev(kind, dir, "refs/remotes/origin/"+spec); err == nil {
+			return rev, nil
+		}
+	}
+	return vcsResolveRev(kind, dir, spec)
+}
+
+// vcsTags lists the tags in the checkout in dir.
+func vcsTags(kind, dir string) ([]string, error) {
+	var out string
+	var err error
+	switch kind {
+	case "git":
+		out, err = vcsOutput(dir, "git", "tag")
+	case "hg":
+		out, err = vcsOutput(dir, "hg", "log", "-r", "tag()", "--template", "{join(tags, '\\n')}\\n")
+	default:
+		return nil, fmt.Errorf("unsupported VCS %q", kind)
+	}
+	if err != nil || out == "" {
+		return nil, err
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// vcsLog returns one line per revision that is in newRev but not oldRev.
+func vcsLog(kind, dir, oldRev, newRev string) ([]string, error) {
+	var out string
+	var err error
+	switch kind {
+	case "git":
+		out, err = vcsOutput(dir, "git", "log", "--oneline", "--no-decorate", oldRev+".."+newRev)
+	case "hg":
+		out, err = vcsOutput(dir, "hg", "log", "-r", fmt.Sprintf("only(%s, %s)", newRev, oldRev),
+			"--template", "{node|short} {desc|firstline}\\n")
+	default:
+		return nil, fmt.Errorf("unsupported VCS %q", kind)
+	}
+	if err != nil || out == "" {
+		return nil, err
+	}
+	return strings.Split(out, "\n"), nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/skelterjohn/wgo/workspaces"
+)
+
+// Pin is a single repository entry in .gocfg/vendor.json.
+type Pin struct {
+	Type string
+	URL  string
+	Rev  string
+}
+
+// vendorConfig maps repository directories, relative to the workspace root,
+// to the revisions they are pinned at. It is the same layout that vend.Save
+// writes and vend.Restore reads.
+type vendorConfig map[string]Pin
+
+func (w *workspace) vendorConfigPath() string {
+	return filepath.Join(w.Root, workspaces.ConfigDirName, "vendor.json")
+}
+
+func (w *workspace) loadVendorConfig() (vendorConfig, error) {
+	cfg := vendorConfig{}
+	fin, err := os.Open(w.vendorConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	defer fin.Close()
+	if err := json.NewDecoder(fin).Decode(&cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// dirs returns the pinned repository directories in sorted order.
+func (cfg vendorConfig) dirs() []string {
+	var dirs []string
+	for dir := range cfg {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// within returns, in sorted order, the pinned directories that are in or
+// under any of dirs. All are relative to the workspace root.
+func (cfg vendorConfig) within(w *workspace, dirs []string) []string {
+	var pins []string
+	for _, pin := range cfg.dirs() {
+		for _, dir := range dirs {
+			if withinDir(filepath.Join(w.Root, dir), filepath.Join(w.Root, pin)) {
+				pins = append(pins, pin)
+				break
+			}
+		}
+	}
+	return pins
+}
+
+// write replaces .gocfg/vendor.json with cfg.
+func (cfg vendorConfig) write(w *workspace) error {
+	data, err := json.MarshalIndent(cfg, "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	tmp := w.vendorConfigPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.vendorConfigPath())
+}
+
+// findPin returns the pinned directory that name refers to. name may be the
+// directory as recorded in vendor.json, or an import path in one of the
+// workspace's gopaths.
+func (w *workspace) findPin(cfg vendorConfig, name string) (string, bool) {
+	candidates := []string{filepath.Clean(name)}
+	for _, gopath := range w.Gopaths {
+		candidates = append(candidates, filepath.Join(gopath, "src", filepath.FromSlash(name)))
+	}
+	for _, dir := range candidates {
+		if _, ok := cfg[dir]; ok {
+			return dir, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,270 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/skelterjohn/wgo/workspaces"
+)
+
+// vendoredCopy records where a package copied in by 'wgo vendor' came from.
+type vendoredCopy struct {
+	ImportPath string
+	// Source is the directory the package was copied from.
+	Source string
+	// Repo is the checkout Source was in, if any, and Type, URL and Rev
+	// describe it.
+	Repo   string `json:",omitempty"`
+	Type   string `json:",omitempty"`
+	URL    string `json:",omitempty"`
+	Rev    string `json:",omitempty"`
+	Copied time.Time
+}
+
+// vendoredCopies maps copied package directories, relative to the workspace
+// root, to their provenance. It is stored in .gocfg/vendored.json.
+type vendoredCopies map[string]vendoredCopy
+
+func (w *workspace) vendoredCopiesPath() string {
+	return filepath.Join(w.Root, workspaces.ConfigDirName, "vendored.json")
+}
+
+// loadVendoredCopies reads .gocfg/vendored.json, which may not exist yet.
+func (w *workspace) loadVendoredCopies() (vendoredCopies, error) {
+	copies := vendoredCopies{}
+	data, err := ioutil.ReadFile(w.vendoredCopiesPath())
+	if os.IsNotExist(err) {
+		return copies, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &copies); err != nil {
+		return nil, fmt.Errorf("%s: %v", w.vendoredCopiesPath(), err)
+	}
+	return copies, nil
+}
+
+// dirs returns the copied package directories in sorted order.
+func (copies vendoredCopies) dirs() []string {
+	var dirs []string
+	for dir := range copies {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// write replaces .gocfg/vendored.json with copies.
+func (copies vendoredCopies) write(w *workspace) error {
+	data, err := json.MarshalIndent(copies, "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	tmp := w.vendoredCopiesPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.vendoredCopiesPath())
+}
+
+// find returns the copied directory that name refers to, either as recorded
+// or by import path.
+func (copies vendoredCopies) find(name string) (string, bool) {
+	if _, ok := copies[filepath.Clean(name)]; ok {
+		return filepath.Clean(name), true
+	}
+	for dir, vc := range copies {
+		if vc.ImportPath == name {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+// provenance describes the package in src, including the checkout it is in,
+// if any.
+func provenance(importPath, src string) vendoredCopy {
+	vc := vendoredCopy{
+		ImportPath: importPath,
+		Source:     src,
+		Copied:     time.Now().UTC().Truncate(time.Second),
+	}
+	for dir := src; ; dir = filepath.Dir(dir) {
+		if kind := vcsKindOf(dir); kind != "" {
+			vc.Repo, vc.Type = dir, kind
+			vc.Rev, _ = vcsHead(kind, dir)
+			vc.URL, _ = vcsOrigin(kind, dir)
+			break
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	return vc
+}
+
+// sourceRev returns the revision vc's source checkout is at now, or "" if the
+// source is gone or isn't a checkout.
+func (vc vendoredCopy) sourceRev() string {
+	if vc.Repo == "" {
+		return ""
+	}
+	rev, err := vcsHead(vc.Type, vc.Repo)
+	if err != nil {
+		return ""
+	}
+	return rev
+}
+
+// copyFromSource replaces the copy in dir with the current contents of its
+// source directory.
+func (w *workspace) copyFromSource(dir string, vc vendoredCopy, opts copyOptions) (vendoredCopy, CopyStats, error) {
+	if _, err := os.Stat(vc.Source); err != nil {
+		return vc, CopyStats{}, err
+	}
+	stats, errs := copyDir(vc.Source, filepath.Join(w.Root, dir), opts)
+	if len(errs) != 0 {
+		return vc, stats, copyError(errs)
+	}
+	return provenance(vc.ImportPath, vc.Source), stats, nil
+}
+
+// copyFromOrigin replaces the copy in dir with the package as of rev in its
+// source repository, fetched through the cache. If rev is "", the tip of the
+// default branch is used.
+func (w *workspace) copyFromOrigin(c *repoCache, dir string, vc vendoredCopy, rev string, opts copyOptions) (vendoredCopy, CopyStats, error) {
+	if vc.URL == "" {
+		return vc, CopyStats{}, fmt.Errorf("%s was not copied from a checkout with an origin", vc.Source)
+	}
+	subdir, err := filepath.Rel(vc.Repo, vc.Source)
+	if err != nil {
+		return vc, CopyStats{}, err
+	}
+	pin := Pin{Type: vc.Type, URL: vc.URL, Rev: vc.Rev}
+	mirror, err := c.ensure(pin)
+	if err != nil {
+		return vc, CopyStats{}, err
+	}
+	if rev == "" && !c.offline {
+		l := c.lock(mirror)
+		l.Lock()
+		err := mirrorUpdate(pin.Type, mirror)
+		l.Unlock()
+		if err != nil {
+			return vc, CopyStats{}, err
+		}
+	}
+
+	tmp, err := ioutil.TempDir("", "wgo-vendored")
+	if err != nil {
+		return vc, CopyStats{}, err
+	}
+	defer os.RemoveAll(tmp)
+	clone := filepath.Join(tmp, "repo")
+	if err := cloneFromMirror(pin, mirror, clone); err != nil {
+		return vc, CopyStats{}, err
+	}
+	if rev == "" {
+		if rev, err = vcsDefaultTip(pin.Type, clone); err != nil {
+			return vc, CopyStats{}, err
+		}
+	}
+	if err := vcsCheckout(pin.Type, clone, rev); err != nil {
+		return vc, CopyStats{}, err
+	}
+	if rev, err = vcsHead(pin.Type, clone); err != nil {
+		return vc, CopyStats{}, err
+	}
+	stats, errs := copyDir(filepath.Join(clone, subdir), filepath.Join(w.Root, dir), opts)
+	if len(errs) != 0 {
+		return vc, stats, copyError(errs)
+	}
+	vc.Rev = rev
+	vc.Copied = time.Now().UTC().Truncate(time.Second)
+	return vc, stats, nil
+}
+
+// refreshVendored re-copies the named vendored packages, or all of them, from
+// their sources, or from their origins if the sources are gone.
+func (w *workspace) refreshVendored(names []string, opts copyOptions) ([]VendoredPackage, CopyStats, []error) {
+	var total CopyStats
+	copies, err := w.loadVendoredCopies()
+	if err != nil {
+		return nil, total, []error{err}
+	}
+	dirs := copies.dirs()
+	if len(names) != 0 {
+		dirs = nil
+		for _, name := range names {
+			dir, ok := copies.find(name)
+			if !ok {
+				return nil, total, []error{fmt.Errorf("%q is not recorded in %s", name, w.vendoredCopiesPath())}
+			}
+			dirs = append(dirs, dir)
+		}
+	}
+
+	c := newRepoCache(CacheDir())
+	var refreshed []VendoredPackage
+	var errs []error
+	for _, dir := range dirs {
+		old := copies[dir]
+		var vc vendoredCopy
+		var stats CopyStats
+		var err error
+		if _, statErr := os.Stat(old.Source); statErr == nil {
+			vc, stats, err = w.copyFromSource(dir, old, opts)
+		} else {
+			vc, stats, err = w.copyFromOrigin(c, dir, old, "", opts)
+		}
+		total.add(stats)
+		if err != nil {
+			errs = append(errs, &ItemError{Item: dir, Err: err})
+			continue
+		}
+		copies[dir] = vc
+		refreshed = append(refreshed, VendoredPackage{
+			ImportPath:  vc.ImportPath,
+			Source:      vc.Source,
+			Destination: dir,
+			Bytes:       stats.Bytes,
+			OldRev:      old.Rev,
+			Rev:         vc.Rev,
+		})
+	}
+	if err := copies.write(w); err != nil {
+		errs = append(errs, err)
+	}
+	return refreshed, total, errs
+}
+
+// restoreVendored recreates a missing vendored copy at its recorded revision,
+// or from its source if it did not come from a checkout with an origin.
+func (w *workspace) restoreVendored(c *repoCache, dir string, vc vendoredCopy) error {
+	if vc.URL != "" && vc.Rev != "" {
+		_, _, err := w.copyFromOrigin(c, dir, vc, vc.Rev, w.copyOptions())
+		return err
+	}
+	_, _, err := w.copyFromSource(dir, vc, w.copyOptions())
+	return err
+}
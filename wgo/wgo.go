@@ -0,0 +1,62 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package wgo implements the wgo commands for use from Go programs. Each
+command is a function that takes a workspace, as found by the workspaces
+package, and an options struct, and returns structured results and an error
+rather than printing and exiting.
+
+Options with a Log field send progress messages and warnings meant for people
+there; a nil Log discards them.
+*/
+package wgo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ItemError is an error about one of the items an operation works through,
+// like a repository or a package directory.
+type ItemError struct {
+	Item string
+	Err  error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Item, e.Err)
+}
+
+// Errors is returned by operations that carry on past failures, with every
+// error they met.
+type Errors []error
+
+func (errs Errors) Error() string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d errors:\n\t%s", len(errs), strings.Join(msgs, "\n\t"))
+}
+
+// errorsOrNil returns errs as an error, or nil if it is empty.
+func errorsOrNil(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return Errors(errs)
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/skelterjohn/wgo/workspaces"
+)
+
+// ImportChain is a chain of imports from one of the workspace's own packages,
+// Root, to the target of Why. Imports starts with Root and ends with the
+// target. If Test is set, Root's tests import the next package.
+type ImportChain struct {
+	Root    string
+	Test    bool
+	Imports []string
+}
+
+// Why finds the shortest import chain from each of the workspace's own
+// packages to the target package, shortest first, with chains through
+// tests last.
+func Why(w *workspaces.Workspace, target string) ([]ImportChain, error) {
+	ws := wrap(w, nil)
+	g, err := ws.loadImportGraph([]string{"./src/..."})
+	if err != nil {
+		return nil, err
+	}
+
+	var chains []ImportChain
+	for _, root := range g.roots {
+		if c := g.shortestChain(root, target); c != nil {
+			chains = append(chains, ImportChain{Root: root, Imports: c})
+		} else if c := g.shortestTestChain(root, target); c != nil {
+			chains = append(chains, ImportChain{Root: root, Test: true, Imports: c})
+		}
+	}
+	if len(chains) == 0 {
+		return nil, fmt.Errorf("%s is not imported by any package in src", target)
+	}
+
+	sort.SliceStable(chains, func(i, j int) bool {
+		if chains[i].Test != chains[j].Test {
+			return !chains[i].Test
+		}
+		return len(chains[i].Imports) < len(chains[j].Imports)
+	})
+	return chains, nil
+}
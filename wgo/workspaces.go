@@ -0,0 +1,70 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wgo
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/skelterjohn/wgo/workspaces"
+)
+
+type workspace struct {
+	workspaces.Workspace
+	// log receives progress messages and warnings meant for people.
+	log io.Writer
+}
+
+// wrap returns the workspace w, logging to log, which may be nil.
+func wrap(w *workspaces.Workspace, log io.Writer) *workspace {
+	if log == nil {
+		log = ioutil.Discard
+	}
+	return &workspace{Workspace: *w, log: log}
+}
+
+func (w *workspace) logf(format string, args ...interface{}) {
+	fmt.Fprintf(w.log, format, args...)
+}
+
+func (w *workspace) vendorRootSrc() string {
+	return filepath.Join(w.VendorPath(), "src")
+}
+
+// goCmd prepares a go command that runs from the workspace root with the
+// workspace's GOPATH and environment.
+func (w *workspace) goCmd(args ...string) (*exec.Cmd, error) {
+	if err := w.CheckGoVersion(); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("go", args...)
+	cmd.Dir = w.Root
+	cmd.Env = w.goEnv()
+	return cmd, nil
+}
+
+// goEnv is this process's environment with the workspace's added, for the go
+// commands wgo runs. The process's own environment is left alone, since wgo
+// may be used as a library.
+func (w *workspace) goEnv() []string {
+	env := os.Environ()
+	for _, ev := range w.Environment() {
+		env = append(env, ev.Key+"="+ev.Value)
+	}
+	return append(env, "GOPATH="+w.Gopath(true))
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skelterjohn/wgo/wgo"
+)
+
+// why prints the shortest import chains from the workspace's own packages to
+// the target package.
+func why(w *workspace, args []string) {
+	if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+		usage()
+	}
+	chains, err := wgo.Why(&w.Workspace, args[0])
+	orExit(err)
+	if jsonOutput {
+		for _, c := range chains {
+			emit(c)
+		}
+		return
+	}
+	for i, c := range chains {
+		if i != 0 {
+			fmt.Println()
+		}
+		if c.Test {
+			fmt.Printf("# %s (test only)\n", c.Root)
+			fmt.Printf("%s [test]\n", c.Root)
+			for _, pkg := range c.Imports[1:] {
+				fmt.Println(pkg)
+			}
+			continue
+		}
+		fmt.Printf("# %s\n", c.Root)
+		for _, pkg := range c.Imports {
+			fmt.Println(pkg)
+		}
+	}
+}
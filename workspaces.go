@@ -14,11 +14,6 @@ limitations under the License.
 package main
 
 import (
-	"log"
-	"os"
-	"os/exec"
-	"path/filepath"
-
 	"github.com/skelterjohn/wgo/workspaces"
 )
 
@@ -42,38 +37,10 @@ func getWorkspace(start string) (*workspace, error) {
 	}
 }
 
-func guessGoCommand(args []string) string {
-	if len(args) < 1 {
-		return ""
-	}
-	return args[1]
-}
-
 func (w *workspace) shellOutToGo(args []string) {
-	// we want to fetch new code directly into the workspace, for convenience
-	gopath := w.Gopath(guessGoCommand(args) != "get")
-	os.Setenv("GOPATH", gopath)
-	log.Printf("using GOPATH=%s", gopath)
-	shellOutToGo(args)
-}
-
-func (w *workspace) vendorRootSrc() string {
-	firstGopath := "."
-	if len(w.Gopaths) != 0 {
-		firstGopath = w.Gopaths[0]
-	}
-	return filepath.Join(firstGopath, "src")
+	w.ShellOutToGo(args)
 }
 
 func shellOutToGo(args []string) {
-	log.Printf("forking to go: %q", args[1:])
-	cmd := exec.Command("go", args[1:]...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
-	if _, ok := err.(*exec.ExitError); ok {
-		os.Exit(1)
-	}
-	os.Exit(0)
+	workspaces.ExecGo(args)
 }
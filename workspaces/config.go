@@ -0,0 +1,256 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspaces
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ConfigFileName is the structured workspace configuration in the
+	// ConfigDirName directory.
+	ConfigFileName = "config"
+	// GopathsFileName is the original, one-gopath-per-line configuration.
+	GopathsFileName = "gopaths"
+
+	// ConfigVersion is the newest version of ConfigFileName understood.
+	ConfigVersion = 1
+)
+
+// Config is the layout of .gocfg/config.
+type Config struct {
+	Version int
+
+	// Gopaths are relative to the workspace root, in GOPATH order.
+	Gopaths []string
+	// VendorGopath is where new dependencies go. It defaults to the first
+	// of Gopaths.
+	VendorGopath string `json:",omitempty"`
+	// BuildTags are passed to every wrapped go command.
+	BuildTags []string `json:",omitempty"`
+	// Env overrides environment variables for every wrapped go command.
+	Env map[string]string `json:",omitempty"`
+	// GoVersion is the oldest go release that may be used, eg "1.6".
+	GoVersion string `json:",omitempty"`
+	// SaveIgnore lists glob patterns, relative to the workspace root, of
+	// directories that wgo save will not record.
+	SaveIgnore []string `json:",omitempty"`
+	// VendorSkip lists glob patterns of files and directories that wgo
+	// vendor does not copy, besides VCS metadata and build outputs.
+	VendorSkip []string `json:",omitempty"`
+	// VendorRejectEscapingLinks makes wgo vendor fail on symlinks that point
+	// outside the package being copied.
+	VendorRejectEscapingLinks bool `json:",omitempty"`
+	// Platforms are the GOOS/GOARCH pairs, like "windows/amd64", whose
+	// dependencies wgo save, vendor, prune and purge collect. A pair may be
+	// followed by ":" and build tags joined by "+". The default is the host.
+	Platforms []string `json:",omitempty"`
+}
+
+func (w *Workspace) configPath() string {
+	return filepath.Join(w.Root, ConfigDirName, ConfigFileName)
+}
+
+func (w *Workspace) gopathsPath() string {
+	return filepath.Join(w.Root, ConfigDirName, GopathsFileName)
+}
+
+// HasConfig reports whether the workspace uses .gocfg/config, rather than
+// the original .gocfg/gopaths.
+func (w *Workspace) HasConfig() bool {
+	_, err := os.Stat(w.configPath())
+	return err == nil
+}
+
+// load reads the workspace's settings, preferring .gocfg/config over
+// .gocfg/gopaths.
+func (w *Workspace) load() error {
+	data, err := ioutil.ReadFile(w.configPath())
+	if os.IsNotExist(err) {
+		return w.loadGopaths()
+	}
+	if err != nil {
+		return err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("%s: %v", w.configPath(), err)
+	}
+	if cfg.Version > ConfigVersion {
+		return fmt.Errorf("%s: version %d is newer than this wgo supports (%d)", w.configPath(), cfg.Version, ConfigVersion)
+	}
+	w.Gopaths = cfg.Gopaths
+	w.VendorGopath = cfg.VendorGopath
+	w.BuildTags = cfg.BuildTags
+	w.Env = cfg.Env
+	w.GoVersion = cfg.GoVersion
+	w.SaveIgnore = cfg.SaveIgnore
+	w.VendorSkip = cfg.VendorSkip
+	w.VendorRejectEscapingLinks = cfg.VendorRejectEscapingLinks
+	w.Platforms = cfg.Platforms
+	return nil
+}
+
+// loadGopaths reads .gocfg/gopaths, one gopath per line. Blank lines and
+// lines starting with '#' are skipped.
+func (w *Workspace) loadGopaths() error {
+	cfgFile, err := os.Open(w.gopathsPath())
+	if err != nil {
+		// A workspace doesn't need any gopaths.
+		return nil
+	}
+	defer cfgFile.Close()
+	sc := bufio.NewScanner(cfgFile)
+	for sc.Scan() {
+		gopath := strings.TrimSpace(sc.Text())
+		if gopath == "" || strings.HasPrefix(gopath, "#") {
+			continue
+		}
+		w.Gopaths = append(w.Gopaths, gopath)
+	}
+	return sc.Err()
+}
+
+// Config returns the workspace's settings as they would be written to
+// .gocfg/config.
+func (w *Workspace) Config() Config {
+	return Config{
+		Version:      ConfigVersion,
+		Gopaths:      w.Gopaths,
+		VendorGopath: w.VendorGopath,
+		BuildTags:    w.BuildTags,
+		Env:          w.Env,
+		GoVersion:    w.GoVersion,
+		SaveIgnore:   w.SaveIgnore,
+
+		VendorSkip:                w.VendorSkip,
+		VendorRejectEscapingLinks: w.VendorRejectEscapingLinks,
+		Platforms:                 w.Platforms,
+	}
+}
+
+// WriteConfig writes the workspace's settings to .gocfg/config.
+func (w *Workspace) WriteConfig() error {
+	data, err := json.MarshalIndent(w.Config(), "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	tmp := w.configPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.configPath())
+}
+
+// MigrateConfig replaces .gocfg/gopaths with an equivalent .gocfg/config.
+func (w *Workspace) MigrateConfig() error {
+	if w.HasConfig() {
+		return fmt.Errorf("%s already exists", w.configPath())
+	}
+	if err := w.WriteConfig(); err != nil {
+		return err
+	}
+	if err := os.Remove(w.gopathsPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// VendorPath returns the gopath, relative to the workspace root, that
+// new dependencies are put in.
+func (w *Workspace) VendorPath() string {
+	if w.VendorGopath != "" {
+		return w.VendorGopath
+	}
+	if len(w.Gopaths) != 0 {
+		return w.Gopaths[0]
+	}
+	return "."
+}
+
+// ApplyEnv sets the workspace's Environment in the current process, so that
+// it is inherited by any command run from here on.
+func (w *Workspace) ApplyEnv() {
+	for _, ev := range w.Environment() {
+		os.Setenv(ev.Key, ev.Value)
+	}
+}
+
+// CheckGoVersion returns an error if the go tool is older than the
+// workspace's required GoVersion.
+func (w *Workspace) CheckGoVersion() error {
+	if w.GoVersion == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	cmd := exec.Command("go", "version")
+	cmd.Stdout = &buf
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go not found: %v", err)
+	}
+	// The output looks like "go version go1.6.2 linux/amd64".
+	fields := strings.Fields(buf.String())
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "go") {
+		return fmt.Errorf("cannot parse go version %q", buf.String())
+	}
+	have := strings.TrimPrefix(fields[2], "go")
+	if strings.HasPrefix(have, "devel") {
+		return nil
+	}
+	if compareGoVersions(have, w.GoVersion) < 0 {
+		return fmt.Errorf("workspace %q requires go %s or newer, found go %s", w.Root, w.GoVersion, have)
+	}
+	return nil
+}
+
+// compareGoVersions compares release numbers like "1.6.2" and "1.7",
+// ignoring any beta or rc suffix.
+func compareGoVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var an, bn int
+		if i < len(as) {
+			an = leadingInt(as[i])
+		}
+		if i < len(bs) {
+			bn = leadingInt(bs[i])
+		}
+		if an != bn {
+			if an < bn {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func leadingInt(s string) int {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	n, _ := strconv.Atoi(s[:i])
+	return n
+}
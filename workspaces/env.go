@@ -0,0 +1,111 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspaces
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EnvFileName is the file in the ConfigDirName directory that holds
+// environment variables for wrapped commands, one KEY=VALUE per line.
+const EnvFileName = "env"
+
+// EnvVar is a single environment variable assignment.
+type EnvVar struct {
+	Key   string
+	Value string
+}
+
+func (w *Workspace) envPath() string {
+	return filepath.Join(w.Root, ConfigDirName, EnvFileName)
+}
+
+// loadEnvFile reads .gocfg/env into w.EnvVars. Values are kept unexpanded
+// until the environment is applied.
+func (w *Workspace) loadEnvFile() error {
+	fin, err := os.Open(w.envPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer fin.Close()
+
+	sc := bufio.NewScanner(fin)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		i := strings.Index(line, "=")
+		if i <= 0 {
+			return fmt.Errorf("%s:%d: expected KEY=VALUE", w.envPath(), n)
+		}
+		key := strings.TrimSpace(line[:i])
+		value := strings.TrimSpace(line[i+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		w.EnvVars = append(w.EnvVars, EnvVar{Key: key, Value: value})
+	}
+	return sc.Err()
+}
+
+// Environment returns the variables the workspace sets for wrapped commands,
+// in the order they are applied: the config's Env, then .gocfg/env, then
+// GOFLAGS for the config's BuildTags. References like ${NAME} are expanded
+// against variables set earlier and then the current environment, and ${W}
+// is the workspace root. GOPATH is not included; it is always set last.
+func (w *Workspace) Environment() []EnvVar {
+	set := map[string]string{}
+	lookup := func(key string) string {
+		if key == "W" {
+			return w.Root
+		}
+		if v, ok := set[key]; ok {
+			return v
+		}
+		return os.Getenv(key)
+	}
+
+	var vars []EnvVar
+	add := func(key, value string) {
+		set[key] = value
+		vars = append(vars, EnvVar{Key: key, Value: value})
+	}
+
+	var keys []string
+	for k := range w.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		add(k, os.Expand(w.Env[k], lookup))
+	}
+	for _, ev := range w.EnvVars {
+		add(ev.Key, os.Expand(ev.Value, lookup))
+	}
+
+	if goflags := lookup("GOFLAGS"); len(w.BuildTags) != 0 && !strings.Contains(goflags, "-tags") {
+		add("GOFLAGS", strings.TrimSpace(goflags+" -tags="+strings.Join(w.BuildTags, ",")))
+	}
+	return vars
+}
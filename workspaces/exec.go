@@ -0,0 +1,119 @@
+/*
+Copyright 2016 Google Inc. All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workspaces
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// errNoExec is returned by execGo on platforms that cannot replace the
+// current process.
+var errNoExec = errors.New("exec is not supported on this platform")
+
+// ExecGo hands the process over to the go tool, passing it args[1:]. Where
+// the platform allows it, the go tool replaces the current process; otherwise
+// it is run as a child and its exit status becomes ours. ExecGo does not
+// return.
+func ExecGo(args []string) {
+	log.Printf("forking to go: %q", args[1:])
+	err := execGo(args[1:])
+	if err == errNoExec {
+		var status int
+		status, err = RunGo(args[1:])
+		if err == nil {
+			os.Exit(status)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%s\n", err)
+	os.Exit(1)
+}
+
+// RunGo runs the go tool with args, forwarding any interrupt or termination
+// signals to it, and returns its exit status. An error is only returned if
+// the go tool could not be run at all.
+func RunGo(args []string) (int, error) {
+	path, err := lookGo()
+	if err != nil {
+		return 0, err
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return runForwardingSignals(cmd)
+}
+
+func lookGo() (string, error) {
+	path, err := exec.LookPath("go")
+	if err != nil {
+		return "", fmt.Errorf("go not found: %v", err)
+	}
+	return path, nil
+}
+
+// runForwardingSignals runs cmd in its own process group and relays signals
+// to that group, so that processes started by cmd are not orphaned when we
+// are interrupted.
+func runForwardingSignals(cmd *exec.Cmd) (int, error) {
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				log.Printf("forwarding %v to go", sig)
+				signalProcessGroup(cmd, sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	signal.Stop(sigs)
+	close(done)
+	return exitStatus(err)
+}
+
+// exitStatus converts the result of running a command into the exit status
+// it finished with. A command killed by a signal is given the status a shell
+// would report, 128 plus the signal number.
+func exitStatus(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return 0, err
+	}
+	if status := exitErr.ExitCode(); status >= 0 {
+		return status, nil
+	}
+	if sig, ok := exitSignal(exitErr); ok {
+		return 128 + sig, nil
+	}
+	return 1, nil
+}
@@ -14,11 +14,10 @@ limitations under the License.
 package workspaces
 
 import (
-	"bufio"
 	"errors"
+	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 )
@@ -30,6 +29,21 @@ const (
 type Workspace struct {
 	Root    string
 	Gopaths []string
+
+	// The fields below can only be set in .gocfg/config. See Config for
+	// their meaning.
+	VendorGopath string
+	BuildTags    []string
+	Env          map[string]string
+	GoVersion    string
+	SaveIgnore   []string
+
+	VendorSkip                []string
+	VendorRejectEscapingLinks bool
+	Platforms                 []string
+
+	// EnvVars are read from .gocfg/env.
+	EnvVars []EnvVar
 }
 
 func GetCurrentWorkspace() (*Workspace, error) {
@@ -47,12 +61,11 @@ func GetWorkspace(start string) (*Workspace, error) {
 		w := &Workspace{
 			Root: start,
 		}
-		if cfgFile, err := os.Open(filepath.Join(goCfgPath, "gopaths")); err == nil {
-			sc := bufio.NewScanner(cfgFile)
-			for sc.Scan() {
-				gopath := sc.Text()
-				w.Gopaths = append(w.Gopaths, strings.TrimSpace(gopath))
-			}
+		if err := w.load(); err != nil {
+			return nil, err
+		}
+		if err := w.loadEnvFile(); err != nil {
+			return nil, err
 		}
 		return w, nil
 	}
@@ -84,6 +97,18 @@ func (w *Workspace) Gopath(external bool) string {
 	return newgopath
 }
 
+// getGopath is the GOPATH for go get, which puts new code in the first entry,
+// so the vendor gopath goes first.
+func (w *Workspace) getGopath() string {
+	gopaths := []string{filepath.Join(w.Root, w.VendorPath())}
+	for _, gopath := range w.Gopaths {
+		if gopath != w.VendorPath() {
+			gopaths = append(gopaths, filepath.Join(w.Root, gopath))
+		}
+	}
+	return strings.Join(gopaths, string(filepath.ListSeparator))
+}
+
 func guessGoCommand(args []string) string {
 	if len(args) < 1 {
 		return ""
@@ -92,22 +117,17 @@ func guessGoCommand(args []string) string {
 }
 
 func (w *Workspace) ShellOutToGo(args []string) {
-	// we want to fetch new code directly into the workspace, for convenience
-	gopath := w.Gopath(guessGoCommand(args) != "get")
-	os.Setenv("GOPATH", gopath)
-	log.Printf("using GOPATH=%s", gopath)
-	shellOutToGo(args)
-}
-
-func shellOutToGo(args []string) {
-	log.Printf("forking to go: %q", args[1:])
-	cmd := exec.Command("go", args[1:]...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
-	if _, ok := err.(*exec.ExitError); ok {
+	if err := w.CheckGoVersion(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
 		os.Exit(1)
 	}
-	os.Exit(0)
+	w.ApplyEnv()
+	gopath := w.Gopath(true)
+	if guessGoCommand(args) == "get" {
+		// we want to fetch new code directly into the workspace, for convenience
+		gopath = w.getGopath()
+	}
+	os.Setenv("GOPATH", gopath)
+	log.Printf("using GOPATH=%s", gopath)
+	ExecGo(args)
 }